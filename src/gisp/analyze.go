@@ -0,0 +1,365 @@
+package main
+
+// Closure compiler: analyzes an expression once into a tree of Go closures, so
+// special forms and primitives are resolved before the expression runs instead
+// of on every evaluation. Lambda bodies are analyzed when the lambda is, and
+// the resulting closures carry their analyzed body as CODE.
+//
+// Local variables are resolved to a (depth, index) address when they are
+// analyzed. At run time they live in flat frames, contiguous blocks of cells
+// holding the enclosing frame, the list of variable names and one slot per
+// variable. Globals are resolved to their slot in the globals table.
+
+// proc is an analyzed expression, run in frame e
+type proc func(e L) L
+
+// Incremented whenever define rebinds a primitive, invalidating resolved calls
+var rebound int
+
+// scope is a frame of local variables during analysis
+type scope struct {
+	names []L
+	vals  []L // literal values of names known to be constant while optimizing, or ERR
+	up    *scope
+}
+
+// lookup returns the depth and index of local variable v
+func (s *scope) lookup(v L) (int, int, bool) {
+	for d := 0; s != nil; s, d = s.up, d+1 {
+		for i := len(s.names) - 1; i >= 0; i-- {
+			if equ(v, s.names[i]) {
+				return d, i, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// newFrame allocates a frame with n slots for the variables in list v under frame up
+func newFrame(v L, n int, up L) L {
+	if I(n)+2 > sp || hp > (sp-I(n)-2)*cellSize {
+		panic("out of memory")
+	}
+	sp -= I(n) + 2
+	cell[sp] = up
+	cell[sp+1] = v
+	for i := sp + 2; i < sp+I(n)+2; i++ {
+		cell[i] = nilv
+	}
+	return box(FRAM, sp)
+}
+
+// slot returns the index in cell of slot i of frame f
+func slot(f L, i int) I {
+	return ord(f) + 2 + I(i)
+}
+
+// frameOf returns environment e as a frame, moving the bindings of an association
+// list in front of the global environment into a new frame
+func frameOf(e L) L {
+	if T(e) == FRAM {
+		return e
+	}
+	var names, vals []L
+	for ; T(e) == CONS && !equ(e, env); e = cdr(e) {
+		names = append(names, car(car(e)))
+		vals = append(vals, cdr(car(e)))
+	}
+	if len(names) == 0 {
+		return nilv
+	}
+	v := nilv
+	for _, w := range names {
+		v = cons(w, v)
+	}
+	f := newFrame(v, len(vals), frameOf(e))
+	for i := range vals {
+		cell[slot(f, i)] = vals[len(vals)-1-i]
+	}
+	return f
+}
+
+// scopeOf returns the scope of the variables in frame f
+func scopeOf(f L) *scope {
+	if T(f) != FRAM {
+		return nil
+	}
+	s := &scope{up: scopeOf(cell[ord(f)])}
+	for v := cell[ord(f)+1]; T(v) == CONS; v = cdr(v) {
+		s.names = append(s.names, car(v))
+	}
+	return s
+}
+
+// listOf returns the elements of xs as a list
+func listOf(xs []L) L {
+	t := nilv
+	for i := len(xs) - 1; i >= 0; i-- {
+		t = cons(xs[i], t)
+	}
+	return t
+}
+
+// analyze translates x into a proc, where sc holds the local variables in scope
+func analyze(x L, sc *scope) proc {
+	switch T(x) {
+	case ATOM:
+		return analyzeVar(x, sc)
+	case CONS:
+		if f := resolve(car(x), sc); T(f) == PRIM {
+			p := &primTab[ord(f)]
+			if p.m {
+				return analyzeForm(p, cdr(x), sc)
+			}
+			return analyzePrim(p, x, sc)
+		}
+		return analyzeCall(x, sc)
+	}
+	return func(L) L { return x }
+}
+
+// analyzeVar resolves variable v to its address in the frames or the globals
+func analyzeVar(v L, sc *scope) proc {
+	d, i, ok := sc.lookup(v)
+	if !ok {
+		g := global(v)
+		return func(L) L { return globals[g] }
+	}
+	switch d {
+	case 0:
+		return func(e L) L { return cell[slot(e, i)] }
+	case 1:
+		return func(e L) L { return cell[slot(cell[ord(e)], i)] }
+	}
+	return func(e L) L {
+		for k := d; k > 0; k-- {
+			e = cell[ord(e)]
+		}
+		return cell[slot(e, i)]
+	}
+}
+
+// resolve returns the primitive that the head of a form names, or () when it is
+// not a primitive or is shadowed by a local variable
+func resolve(v L, sc *scope) L {
+	if T(v) != ATOM {
+		return nilv
+	}
+	if _, _, ok := sc.lookup(v); ok {
+		return nilv
+	}
+	if f := globals[global(v)]; T(f) == PRIM && ord(f) < I(len(primTab)) {
+		return f
+	}
+	return nilv
+}
+
+// named reports whether x is a form headed by the primitive named s
+func named(x L, s string, sc *scope) bool {
+	if T(x) != CONS {
+		return false
+	}
+	f := resolve(car(x), sc)
+	return T(f) == PRIM && primTab[ord(f)].s == s
+}
+
+// analyzeArgs analyzes the argument list t, including an atom after a dot
+func analyzeArgs(t L, sc *scope) ([]proc, proc) {
+	var ps []proc
+	for ; T(t) == CONS; t = cdr(t) {
+		ps = append(ps, analyze(car(t), sc))
+	}
+	if T(t) == ATOM {
+		return ps, analyze(t, sc)
+	}
+	return ps, nil
+}
+
+// evargs evaluates the analyzed arguments from left to right into a list
+func evargs(ps []proc, rest proc, e L) L {
+	if len(ps) == 0 {
+		if rest != nil {
+			return rest(e)
+		}
+		return nilv
+	}
+	x := ps[0](e)
+	return cons(x, evargs(ps[1:], rest, e))
+}
+
+// analyzeCall analyzes the application of a function that is only known when it
+// runs, evaluating the arguments of an analyzed closure straight into its frame
+func analyzeCall(x L, sc *scope) proc {
+	head := analyze(car(x), sc)
+	ps, rest := analyzeArgs(cdr(x), sc)
+	return func(e L) L {
+		f := head(e)
+		if T(f) == PRIM && ord(f) < I(len(primTab)) && primTab[ord(f)].m {
+			return primTab[ord(f)].f(cdr(x), e)
+		}
+		if p := compiled(f); p != nil && p.run != nil && rest == nil && !p.rest {
+			fr := newFrame(p.vars, p.nslots, cdr(f))
+			for i, q := range ps {
+				if y := q(e); i < p.nargs {
+					cell[slot(fr, i)] = y
+				}
+			}
+			for i := len(ps); i < p.nargs; i++ {
+				cell[slot(fr, i)] = err
+			}
+			n := enterCall(x, f)
+			y := p.run(fr)
+			calls = calls[:n]
+			if equ(y, err) {
+				t := nilv
+				for i := min(len(ps), p.nargs) - 1; i >= 0; i-- {
+					t = cons(cell[slot(fr, i)], t)
+				}
+				failed(x, f, t)
+			}
+			return y
+		}
+		return called(x, f, evargs(ps, rest, e))
+	}
+}
+
+// analyzePrim analyzes a call of primitive p, applying the current value of its
+// name to the same analyzed arguments instead if it is redefined later
+func analyzePrim(p *prim, x L, sc *scope) proc {
+	ps, rest := analyzeArgs(cdr(x), sc)
+	g, n := global(car(x)), rebound
+	f := globals[g]
+	return func(e L) L {
+		if n != rebound && !equ(globals[g], f) {
+			h := globals[g]
+			if T(h) == PRIM && ord(h) < I(len(primTab)) && primTab[ord(h)].m {
+				return primTab[ord(h)].f(cdr(x), e)
+			}
+			return called(x, h, evargs(ps, rest, e))
+		}
+		t := evargs(ps, rest, e)
+		y := p.f(t, e)
+		if equ(y, err) {
+			failed(x, box(PRIM, 0), t)
+		}
+		return y
+	}
+}
+
+// analyzeForm analyzes special form p applied to the unevaluated arguments t
+func analyzeForm(p *prim, t L, sc *scope) proc {
+	switch p.s {
+	case "quote":
+		x := car(t)
+		return func(L) L { return x }
+	case "if":
+		c, a, b := analyze(car(t), sc), analyze(car(cdr(t)), sc), analyze(car(cdr(cdr(t))), sc)
+		return func(e L) L {
+			if notv(c(e)) {
+				return b(e)
+			}
+			return a(e)
+		}
+	case "cond":
+		var tests, bodies []proc
+		for ; T(t) == CONS; t = cdr(t) {
+			tests = append(tests, analyze(car(car(t)), sc))
+			bodies = append(bodies, analyze(car(cdr(car(t))), sc))
+		}
+		return func(e L) L {
+			for i, c := range tests {
+				if !notv(c(e)) {
+					return bodies[i](e)
+				}
+			}
+			return err
+		}
+	case "and", "or":
+		var ps []proc
+		for ; T(t) == CONS; t = cdr(t) {
+			ps = append(ps, analyze(car(t), sc))
+		}
+		and := p.s == "and"
+		return func(e L) L {
+			x := nilv
+			if and {
+				x = tru
+			}
+			for _, q := range ps {
+				if x = q(e); notv(x) == and {
+					break
+				}
+			}
+			return x
+		}
+	case "let*":
+		if !letv(t) {
+			return analyze(car(t), sc)
+		}
+		s := &scope{up: sc}
+		var vals []proc
+		for ; letv(t); t = cdr(t) {
+			vals = append(vals, analyze(car(cdr(car(t))), s))
+			s.names = append(s.names, car(car(t)))
+		}
+		body := analyze(car(t), s)
+		v := listOf(s.names)
+		return func(e L) L {
+			f := newFrame(v, len(vals), e)
+			for i, q := range vals {
+				cell[slot(f, i)] = q(f)
+			}
+			return body(f)
+		}
+	case "lambda":
+		return analyzeLambda(car(t), car(cdr(t)), nilv, sc)
+	case "define":
+		v := car(t)
+		var val proc
+		if x := car(cdr(t)); named(x, "lambda", sc) {
+			val = analyzeLambda(car(cdr(x)), car(cdr(cdr(x))), v, sc)
+		} else {
+			val = analyze(x, sc)
+		}
+		return func(e L) L {
+			define(v, val(e))
+			return v
+		}
+	}
+	return func(e L) L { return p.f(t, e) }
+}
+
+// analyzeLambda analyzes the body x of a lambda with parameters v once, returning
+// a proc that creates closures sharing the analyzed body
+func analyzeLambda(v, x, name L, sc *scope) proc {
+	p := &proto{name: name, params: v, body: x}
+	s := &scope{up: sc}
+	w := v
+	for ; T(w) == CONS; w = cdr(w) {
+		s.names = append(s.names, car(w))
+		p.nargs++
+	}
+	if T(w) == ATOM {
+		s.names = append(s.names, w)
+		p.rest = true
+	}
+	p.nslots = len(s.names)
+	p.vars = listOf(s.names)
+	p.run = analyze(x, s)
+	codes = append(codes, p)
+	k := entry(CODE, len(codes))
+	return func(e L) L { return closure(v, k, e) }
+}
+
+// enter returns a frame for a call of analyzed code p with the arguments t
+func (p *proto) enter(t, up L) L {
+	f := newFrame(p.vars, p.nslots, up)
+	for i := 0; i < p.nargs; i++ {
+		cell[slot(f, i)] = car(t)
+		t = cdr(t)
+	}
+	if p.rest {
+		cell[slot(f, p.nargs)] = t
+	}
+	return f
+}
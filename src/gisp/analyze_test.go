@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests for the closure compiler in analyze.go, which eval runs every expression through
+
+// evalAll parses and evaluates every expression in input, returning the last result
+func evalAll(input string) L {
+	p := newReader(strings.NewReader(input))
+	x := nilv
+	for y, e := p.read(); e == nil; y, e = p.read() {
+		x = eval(y, env)
+	}
+	return x
+}
+
+func TestAnalyzedClosures(t *testing.T) {
+	initTinyLisp()
+	f := evalAll("(define sq (lambda (x) (* x x))) sq")
+	if T(f) != CLOS || T(cdr(car(f))) != CODE {
+		t.Fatal("lambda should create a closure with an analyzed body")
+	}
+	if p := compiled(f); p == nil || p.run == nil || !equ(p.name, atom("sq")) {
+		t.Error("the analyzed body of sq should be named sq")
+	}
+	n := len(codes)
+	for i := 0; i < 10; i++ {
+		if result := evalAll("(sq 7)"); !equ(result, L(49)) {
+			t.Fatalf("(sq 7) = %f, want 49", float64(result))
+		}
+	}
+	if len(codes) != n {
+		t.Errorf("calling sq analyzed %d more lambdas, want 0", len(codes)-n)
+	}
+}
+
+func TestAnalyzedScoping(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected L
+	}{
+		{"local shadows special form", "((lambda (if) (if 1 2)) -)", -1},
+		{"local shadows primitive", "((lambda (+) (+ 5 2)) -)", 3},
+		{"let* shadows special form", "(let* (quote car) (quote (cons 4 5)))", 4},
+		{"eval sees local variables", "((lambda (x) (eval 'x)) 5)", 5},
+		{"special form as a value", "((lambda (f) (f #t 1 2)) if)", 1},
+		{"static scoping", "(let* (x 2) ((let* (f +) (x 1) (lambda (y) (f x y))) x))", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseAndEval(tt.input)
+			if !equ(result, tt.expected) {
+				t.Errorf("%s = %f, want %f", tt.input, float64(result), float64(tt.expected))
+			}
+		})
+	}
+}
+
+func TestAnalyzedRedefinition(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define f (lambda (x) (+ x 1)))")
+	if result := evalAll("(f 1)"); !equ(result, L(2)) {
+		t.Fatalf("(f 1) = %f, want 2", float64(result))
+	}
+	evalAll("(define + -)")
+	if result := evalAll("(f 1)"); !equ(result, L(0)) {
+		t.Errorf("(f 1) after redefining + = %f, want 0", float64(result))
+	}
+}
+
+func TestRedefinitionAcrossGC(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define f (lambda (v) (vector-map (lambda (x) (+ x 1)) v)))")
+	gc()
+	evalAll("(define car car)")
+	gc()
+	for i := 0; i < 2; i++ {
+		if x := evalAll("(f (vector 1 2))"); printed(x) != "#(2 3)" {
+			t.Errorf("(f (vector 1 2)) after redefining car = %s, want #(2 3)", printed(x))
+		}
+		gc()
+	}
+}
+
+func TestAnalyzedDotCall(t *testing.T) {
+	initTinyLisp()
+	content, e := os.ReadFile("../../tests/dotcall.lisp")
+	if e != nil {
+		t.Skip("tests/dotcall.lisp not found")
+	}
+	p := newReader(bytes.NewReader(content))
+	for x, e := p.read(); e == nil; x, e = p.read() {
+		x = eval(x, env)
+		if T(x) == CONS && !equ(car(x), atom("passed")) {
+			t.Errorf("dotcall test failed: %v", cdr(x))
+		}
+	}
+}
+
+func TestLexicalAddressing(t *testing.T) {
+	initTinyLisp()
+	sc := &scope{names: []L{atom("c")}, up: &scope{names: []L{atom("a"), atom("b")}}}
+	if d, i, ok := sc.lookup(atom("b")); !ok || d != 1 || i != 1 {
+		t.Errorf("b should be at (1, 1), got (%d, %d)", d, i)
+	}
+	if _, _, ok := sc.lookup(atom("z")); ok {
+		t.Error("z should not be a local variable")
+	}
+
+	result := evalAll(`
+		(define f (lambda (a) (lambda (b) (let* (c 3) (lambda (d) (+ a b c d))))))
+		(((f 1) 2) 4)`)
+	if !equ(result, L(10)) {
+		t.Errorf("deeply nested variables = %f, want 10", float64(result))
+	}
+	g := evalAll("((f 1) 2)")
+	if T(cdr(g)) != FRAM || !equ(cell[slot(cdr(g), 0)], L(3)) {
+		t.Error("closure should capture the let* frame holding c")
+	}
+
+	result = eval(readOne("(+ x y)"), pair(atom("x"), L(1), pair(atom("y"), L(2), env)))
+	if !equ(result, L(3)) {
+		t.Errorf("eval in an association list = %f, want 3", float64(result))
+	}
+}
+
+func TestGlobalSlots(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define x 1) (define get (lambda () x))")
+	g := global(atom("x"))
+	if !equ(globals[g], L(1)) || !equ(gnames[g], atom("x")) {
+		t.Error("x should be bound to 1 in its global slot")
+	}
+	if result := evalAll("(define x 2) (get)"); !equ(result, L(2)) {
+		t.Errorf("(get) after redefining x = %f, want 2", float64(result))
+	}
+	if global(atom("x")) != g {
+		t.Error("redefining x should keep its slot")
+	}
+	if result := evalAll("(define h (lambda () undefined)) (h)"); !equ(result, err) {
+		t.Error("an unbound global should evaluate to ERR")
+	}
+	if result := evalAll("(define undefined 7) (h)"); !equ(result, L(7)) {
+		t.Errorf("(h) after defining undefined = %f, want 7", float64(result))
+	}
+}
+
+func TestEnvironmentBindings(t *testing.T) {
+	initTinyLisp()
+	n := len(globals)
+	evalAll("(define x 1) (define x 2) (define x 3)")
+	if len(globals) != n+1 {
+		t.Errorf("redefining x added %d globals, want 1", len(globals)-n)
+	}
+	x := nilv
+	for b := evalAll("(environment-bindings)"); T(b) == CONS; b = cdr(b) {
+		if equ(car(car(b)), atom("x")) {
+			if !notv(x) {
+				t.Error("x should be listed once")
+			}
+			x = cdr(car(b))
+		}
+	}
+	if !equ(x, L(3)) {
+		t.Errorf("environment-bindings lists x as %f, want 3", float64(x))
+	}
+}
+
+func TestGlobalsSurviveGC(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define xs '(1 2 3))")
+	mark := sp
+	gc()
+	if sp != mark {
+		t.Error("gc should keep the cells of the latest define")
+	}
+	evalAll("(cons 4 5)")
+	gc()
+	if sp != mark {
+		t.Error("gc should free the cells allocated after the latest define")
+	}
+	if result := evalAll("(car (cdr xs))"); !equ(result, L(2)) {
+		t.Errorf("(car (cdr xs)) after gc = %f, want 2", float64(result))
+	}
+}
+
+func TestRedefinitionReclaimed(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define n 0)")
+	gc()
+	mark := sp
+	for i := 0; i < 5000; i++ {
+		evalAll("(define n (+ n 1))")
+		gc()
+	}
+	if sp != mark {
+		t.Errorf("redefining n as a number should not keep the forms from gc, %d cells lost", mark-sp)
+	}
+	if x := evalAll("n"); !equ(x, L(5000)) {
+		t.Errorf("n = %f, want 5000", float64(x))
+	}
+}
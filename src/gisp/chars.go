@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Characters: Unicode code points boxed with the CHAR tag, read as #\a,
+// #\space or #\x41, and character I/O on the standard input and output.
+
+// Names of characters read and printed by name
+var charNames = map[string]rune{
+	"space":   ' ',
+	"newline": '\n',
+	"tab":     '\t',
+	"return":  '\r',
+	"nul":     0,
+}
+
+// char returns character c, ERR if c is too large to box
+func char(c rune) L {
+	if c < 0 || I(c) > maxOrd {
+		return err
+	}
+	return box(CHAR, I(c))
+}
+
+// charName returns character c in #\ syntax
+func charName(c rune) string {
+	for s, r := range charNames {
+		if r == c {
+			return `#\` + s
+		}
+	}
+	if !unicode.IsPrint(c) {
+		return `#\x` + strconv.FormatInt(int64(c), 16)
+	}
+	return `#\` + string(c)
+}
+
+// readChar reads a character literal after its #\ prefix, errChar if it names no character
+func (p *reader) readChar() (L, error) {
+	c := p.next()
+	if c == eof {
+		return err, io.ErrUnexpectedEOF
+	}
+	var b strings.Builder
+	b.WriteRune(c)
+	for !delimiter(p.peek()) {
+		b.WriteRune(p.next())
+	}
+	s := b.String()
+	if utf8.RuneCountInString(s) == 1 {
+		return char(c), nil
+	}
+	if r, ok := charNames[s]; ok {
+		return char(r), nil
+	}
+	if n, e := strconv.ParseInt(strings.TrimPrefix(s, "x"), 16, 32); s[0] == 'x' && e == nil && utf8.ValidRune(rune(n)) {
+		return char(rune(n)), nil
+	}
+	return err, fmt.Errorf("%w #\\%s", errChar, s)
+}
+
+// Return #t if the argument is a character
+func f_charp(t, e L) L {
+	if T(car(t)) == CHAR {
+		return tru
+	}
+	return nilv
+}
+
+// Return the code point of a character
+func f_char_integer(t, e L) L {
+	if T(car(t)) != CHAR {
+		return err
+	}
+	return L(ord(car(t)))
+}
+
+// Return the character of a code point
+func f_integer_char(t, e L) L {
+	if n := car(t); number(n) && n >= 0 && utf8.ValidRune(rune(n)) {
+		return char(rune(n))
+	}
+	return err
+}
+
+// mapChar returns a primitive converting a character with f
+func mapChar(f func(rune) rune) func(t, e L) L {
+	return func(t, e L) L {
+		if T(car(t)) != CHAR {
+			return err
+		}
+		return char(f(rune(ord(car(t)))))
+	}
+}
+
+// testChar returns a primitive that checks a character with f
+func testChar(f func(rune) bool) func(t, e L) L {
+	return func(t, e L) L {
+		if T(car(t)) == CHAR && f(rune(ord(car(t)))) {
+			return tru
+		}
+		return nilv
+	}
+}
+
+// compareChars returns a primitive that checks that each character argument is
+// ordered before the next one by ok
+func compareChars(ok func(a, b rune) bool) func(t, e L) L {
+	return func(t, e L) L {
+		for ; T(t) == CONS; t = cdr(t) {
+			if T(car(t)) != CHAR {
+				return err
+			}
+			if T(cdr(t)) == CONS && T(car(cdr(t))) == CHAR && !ok(rune(ord(car(t))), rune(ord(car(cdr(t))))) {
+				return nilv
+			}
+		}
+		return tru
+	}
+}
+
+// Character conversions, predicates and comparisons
+var (
+	f_char_upcase     = mapChar(unicode.ToUpper)
+	f_char_downcase   = mapChar(unicode.ToLower)
+	f_char_alphabetic = testChar(unicode.IsLetter)
+	f_char_numeric    = testChar(unicode.IsDigit)
+	f_char_whitespace = testChar(unicode.IsSpace)
+	f_char_eq         = compareChars(func(a, b rune) bool { return a == b })
+	f_char_lt         = compareChars(func(a, b rune) bool { return a < b })
+)
+
+// Return the character at an index of a string
+func f_string_ref(t, e L) L {
+	if T(car(t)) != STRG {
+		return err
+	}
+	r := []rune(text(car(t)))
+	if i := car(cdr(t)); i >= 0 && int(i) < len(r) {
+		return char(r[int(i)])
+	}
+	return err
+}
+
+// Return the list of characters of a string
+func f_string_list(t, e L) L {
+	if T(car(t)) != STRG {
+		return err
+	}
+	var xs []L
+	for _, c := range text(car(t)) {
+		xs = append(xs, char(c))
+	}
+	return listOf(xs)
+}
+
+// Return the string of a list of characters
+func f_list_string(t, e L) L {
+	var b strings.Builder
+	for x := car(t); T(x) == CONS; x = cdr(x) {
+		if T(car(x)) != CHAR {
+			return err
+		}
+		b.WriteRune(rune(ord(car(x))))
+	}
+	return str(b.String())
+}
+
+// charOrNil returns character c read by a reader, () if c is eof
+func charOrNil(c rune) L {
+	if c == eof {
+		return nilv
+	}
+	return char(c)
+}
+
+// Read the next character from the standard input or in a reader macro, () at the end of the input
+func f_read_char(t, e L) L {
+	if p := macroReader; p != nil {
+		return charOrNil(p.next())
+	}
+	c, _, e2 := rdr.ReadRune()
+	if e2 == io.EOF {
+		return nilv
+	}
+	return char(c)
+}
+
+// Return the next character of the standard input or in a reader macro without
+// reading it, () at the end of the input
+func f_peek_char(t, e L) L {
+	if p := macroReader; p != nil {
+		return charOrNil(p.peek())
+	}
+	c, _, e2 := rdr.ReadRune()
+	if e2 == io.EOF {
+		return nilv
+	}
+	rdr.UnreadRune()
+	return char(c)
+}
+
+// Write a character to the standard output or a port
+func f_write_char(t, e L) L {
+	w, ok := outputPort(cdr(t))
+	if T(car(t)) != CHAR || !ok {
+		return err
+	}
+	fmt.Fprint(w, string(rune(ord(car(t)))))
+	return car(t)
+}
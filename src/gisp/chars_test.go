@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// Tests for the character type and character I/O in chars.go
+
+func TestCharLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected rune
+		printed  string
+	}{
+		{`#\a`, 'a', `#\a`},
+		{`#\space`, ' ', `#\space`},
+		{`#\newline`, '\n', `#\newline`},
+		{`#\x41`, 'A', `#\A`},
+		{`#\x`, 'x', `#\x`},
+		{`#\(`, '(', `#\(`},
+		{`#\λ`, 'λ', `#\λ`},
+		{`#\x7f`, 0x7f, `#\x7f`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			x := readOne(tt.input)
+			if T(x) != CHAR || rune(ord(x)) != tt.expected {
+				t.Fatalf("%s should read as %q", tt.input, tt.expected)
+			}
+			if got := charName(rune(ord(x))); got != tt.printed {
+				t.Errorf("%s prints as %s, want %s", tt.input, got, tt.printed)
+			}
+		})
+	}
+}
+
+func TestCharsInList(t *testing.T) {
+	initTinyLisp()
+	x := readOne(`(#\( #\) #\é #t)`)
+	if !equ(car(x), char('(')) || !equ(car(cdr(x)), char(')')) || !equ(car(cdr(cdr(x))), char('é')) || !equ(car(cdr(cdr(cdr(x)))), tru) {
+		t.Error(`(#\( #\) #\é #t) should read as three characters and #t`)
+	}
+}
+
+func TestCharLibrary(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected L
+	}{
+		{`(char->integer #\A)`, 65},
+		{`(integer->char 955)`, char('λ')},
+		{`(char-upcase #\λ)`, char('Λ')},
+		{`(char-downcase #\A)`, char('a')},
+		{`(char? #\a)`, tru},
+		{`(char? "a")`, nilv},
+		{`(char-alphabetic? #\é)`, tru},
+		{`(char-numeric? #\7)`, tru},
+		{`(char-whitespace? #\a)`, nilv},
+		{`(char=? #\a #\a)`, tru},
+		{`(char<? #\a #\b #\c)`, tru},
+		{`(char<? #\b #\a)`, nilv},
+		{`(string-ref "héj" 1)`, char('é')},
+		{`(string-ref "héj" 3)`, err},
+		{`(car (cdr (string->list "héj")))`, char('é')},
+		{`(string-length (list->string (string->list "héj")))`, 3},
+		{`(integer->char -1)`, err},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			if result := evalAll(tt.input); !equ(result, tt.expected) {
+				t.Errorf("%s = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReadChar(t *testing.T) {
+	initTinyLisp()
+	saved := rdr
+	defer func() { rdr = saved }()
+	rdr = bufio.NewReader(strings.NewReader("λx"))
+	if c := evalAll("(peek-char)"); !equ(c, char('λ')) {
+		t.Errorf("(peek-char) = %v, want λ", c)
+	}
+	if c := evalAll("(read-char)"); !equ(c, char('λ')) {
+		t.Errorf("(read-char) = %v, want λ", c)
+	}
+	if c := evalAll("(read-char)"); !equ(c, char('x')) {
+		t.Errorf("(read-char) = %v, want x", c)
+	}
+	if c := evalAll("(read-char)"); !notv(c) {
+		t.Error("(read-char) at the end of the input should return ()")
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Bytecode compiler: translates s-expressions into code for the VM in vm.go.
+// Local variables live in numbered stack slots, variables captured from an
+// enclosing lambda are copied into the closure when it is created, and every
+// other atom is resolved to its slot in the globals table.
+
+// Opcodes, each followed by 16-bit operands as noted
+const (
+	opConst      byte = iota // k: push constant k
+	opLocal                  // i: push local slot i
+	opFree                   // i: push captured value i
+	opGlobal                 // g: push global slot g
+	opSet                    // i: pop into local slot i
+	opDefine                 // k: pop and bind atom constant k globally, push the atom
+	opPop                    // drop the top of the stack
+	opJump                   // a: continue at address a
+	opFalse                  // a: pop, continue at address a if the value is ()
+	opAnd                    // a: continue at address a if the top is (), else pop
+	opOr                     // a: continue at address a if the top is not (), else pop
+	opClosure                // k n: pop n captured values, push a closure over code k
+	opCall                   // n: call the function below n arguments
+	opTail                   // n: tail call the function below n arguments
+	opSpread                 // n: call with n arguments followed by a list of arguments
+	opTailSpread             // n: tail call with n arguments followed by a list of arguments
+	opEval                   // k n: pop n local values, evaluate constant k with the interpreter
+	opReturn                 // return the top of the stack
+)
+
+// Error of code whose addresses, constants, slots or argument counts do not fit in
+// the 16-bit operands
+var errOperand = errors.New("code too large for the VM")
+
+// Opcode names and operand counts for disassemble
+var opNames = []string{"CONST", "LOCAL", "FREE", "GLOBAL", "SET", "DEFINE", "POP", "JUMP", "FALSE", "AND", "OR",
+	"CLOSURE", "CALL", "TAIL", "SPREAD", "TAILSPREAD", "EVAL", "RETURN"}
+var opArgs = []int{1, 1, 1, 1, 1, 1, 0, 1, 1, 1, 1, 2, 1, 1, 1, 1, 2, 0}
+
+// proto is a compiled lambda body
+type proto struct {
+	name   L    // atom the lambda was defined as, or ()
+	params L    // parameter list as written
+	body   L    // body as written
+	run    proc // analyzed body when the lambda was analyzed rather than compiled
+	vars   L    // list of parameter names, the variables of an analyzed frame
+	nargs  int  // number of required parameters
+	rest   bool // whether the remaining arguments are bound as a list after the required ones
+	nslots int  // parameter and let* slots, captured values follow
+	nfree  int  // number of captured values
+	code   []byte
+	consts []L
+	sites  []L // call forms by the address of their call instruction
+}
+
+// site returns the call form of the call instruction at address a
+func (p *proto) site(a int) L {
+	if a < len(p.sites) {
+		return p.sites[a]
+	}
+	return nilv
+}
+
+// Compiled and analyzed code boxed with the CODE tag by index, and the number of
+// codes after the latest define; like strings, the code of top-level forms and
+// of closures made after the latest define is freed by gc
+var (
+	codes   []*proto
+	codetop int
+)
+
+// compiler holds the state of the lambda being compiled
+type compiler struct {
+	p    *proto
+	up   *compiler
+	vars []L   // local variables in scope, innermost last
+	slot []int // slot of each variable in vars
+	free []L   // variables captured from enclosing lambdas, in capture order
+}
+
+// compile translates a top-level expression into code that takes no arguments
+func compile(x L) (*proto, error) {
+	c := &compiler{p: &proto{name: nilv, params: nilv}}
+	e := checked(func() {
+		c.expr(x, true)
+		c.emit(opReturn)
+	})
+	return c.p, e
+}
+
+// checked runs f, which compiles code, returning errOperand if an operand of the
+// code does not fit
+func checked(f func()) (e error) {
+	defer func() {
+		if r := recover(); r == errOperand {
+			e = errOperand
+		} else if r != nil {
+			panic(r)
+		}
+	}()
+	f()
+	return nil
+}
+
+// compileLambda translates the parameters v and body x of a lambda
+func compileLambda(v, x L, up *compiler) *compiler {
+	c := &compiler{p: &proto{name: nilv, params: v, body: x}, up: up}
+	for T(v) == CONS {
+		c.local(car(v))
+		c.p.nargs++
+		v = cdr(v)
+	}
+	if T(v) == ATOM {
+		c.local(v)
+		c.p.rest = true
+	}
+	c.expr(x, true)
+	c.emit(opReturn)
+	c.p.nfree = len(c.free)
+	return c
+}
+
+// emit appends instruction op with its operands
+func (c *compiler) emit(op byte, args ...int) {
+	c.p.code = append(c.p.code, op)
+	for _, a := range args {
+		c.p.code = binary.LittleEndian.AppendUint16(c.p.code, operand(a))
+	}
+}
+
+// operand returns a as a 16-bit operand, raising errOperand if it does not fit
+func operand(a int) uint16 {
+	if a < 0 || a > math.MaxUint16 {
+		panic(errOperand)
+	}
+	return uint16(a)
+}
+
+// label returns the address of the next instruction
+func (c *compiler) label() int {
+	return len(c.p.code)
+}
+
+// patch sets the jump at address a to continue at the next instruction
+func (c *compiler) patch(a int) {
+	binary.LittleEndian.PutUint16(c.p.code[a+1:], operand(c.label()))
+}
+
+func (c *compiler) constant(x L) int {
+	for i, y := range c.p.consts {
+		if equ(x, y) {
+			return i
+		}
+	}
+	c.p.consts = append(c.p.consts, x)
+	return len(c.p.consts) - 1
+}
+
+// local allocates a new slot for variable v
+func (c *compiler) local(v L) int {
+	i := len(c.vars)
+	c.vars = append(c.vars, v)
+	c.slot = append(c.slot, i)
+	if i >= c.p.nslots {
+		c.p.nslots = i + 1
+	}
+	return i
+}
+
+// bound reports whether v is a local variable of c or of an enclosing lambda
+func (c *compiler) bound(v L) bool {
+	for ; c != nil; c = c.up {
+		for _, w := range c.vars {
+			if equ(v, w) {
+				return true
+			}
+		}
+		for _, w := range c.free {
+			if equ(v, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// variable emits the code to push the value of variable v
+func (c *compiler) variable(v L) {
+	for i := len(c.vars) - 1; i >= 0; i-- {
+		if equ(v, c.vars[i]) {
+			c.emit(opLocal, c.slot[i])
+			return
+		}
+	}
+	for i, w := range c.free {
+		if equ(v, w) {
+			c.emit(opFree, i)
+			return
+		}
+	}
+	if c.up.bound(v) {
+		c.free = append(c.free, v)
+		c.emit(opFree, len(c.free)-1)
+		return
+	}
+	c.emit(opGlobal, global(v))
+}
+
+// form returns the special form primitive that x names, if any
+func (c *compiler) form(x L) *prim {
+	if T(x) != ATOM || c.bound(x) {
+		return nil
+	}
+	f := globals[global(x)]
+	if T(f) == PRIM && ord(f) < I(len(primTab)) && primTab[ord(f)].m {
+		return &primTab[ord(f)]
+	}
+	return nil
+}
+
+// expr emits the code for x, tail is true when x is in tail position
+func (c *compiler) expr(x L, tail bool) {
+	switch T(x) {
+	case ATOM:
+		c.variable(x)
+	case CONS:
+		if f := c.form(car(x)); f != nil {
+			c.special(f, cdr(x), tail)
+		} else {
+			c.call(x, tail)
+		}
+	default:
+		c.emit(opConst, c.constant(x))
+	}
+}
+
+// call emits a function application, spreading an atom after a dot as arguments
+func (c *compiler) call(x L, tail bool) {
+	c.expr(car(x), false)
+	n := 0
+	t := cdr(x)
+	for ; T(t) == CONS; t = cdr(t) {
+		c.expr(car(t), false)
+		n++
+	}
+	op := opCall
+	switch {
+	case T(t) == ATOM && tail:
+		c.variable(t)
+		op = opTailSpread
+	case T(t) == ATOM:
+		c.variable(t)
+		op = opSpread
+	case tail:
+		op = opTail
+	}
+	for len(c.p.sites) < c.label() {
+		c.p.sites = append(c.p.sites, nilv)
+	}
+	c.p.sites = append(c.p.sites, x)
+	c.emit(op, n)
+}
+
+// special emits the code for special form f applied to the unevaluated arguments t
+func (c *compiler) special(f *prim, t L, tail bool) {
+	switch f.s {
+	case "quote":
+		c.emit(opConst, c.constant(car(t)))
+	case "if":
+		c.expr(car(t), false)
+		a := c.label()
+		c.emit(opFalse, 0)
+		c.expr(car(cdr(t)), tail)
+		b := c.label()
+		c.emit(opJump, 0)
+		c.patch(a)
+		c.expr(car(cdr(cdr(t))), tail)
+		c.patch(b)
+	case "cond":
+		var ends []int
+		for ; T(t) == CONS; t = cdr(t) {
+			c.expr(car(car(t)), false)
+			a := c.label()
+			c.emit(opFalse, 0)
+			c.expr(car(cdr(car(t))), tail)
+			ends = append(ends, c.label())
+			c.emit(opJump, 0)
+			c.patch(a)
+		}
+		c.emit(opConst, c.constant(err))
+		for _, a := range ends {
+			c.patch(a)
+		}
+	case "and", "or":
+		if notv(t) {
+			if f.s == "and" {
+				c.emit(opConst, c.constant(tru))
+			} else {
+				c.emit(opConst, c.constant(nilv))
+			}
+			return
+		}
+		op := opAnd
+		if f.s == "or" {
+			op = opOr
+		}
+		var ends []int
+		for ; T(cdr(t)) == CONS; t = cdr(t) {
+			c.expr(car(t), false)
+			ends = append(ends, c.label())
+			c.emit(op, 0)
+		}
+		c.expr(car(t), tail)
+		for _, a := range ends {
+			c.patch(a)
+		}
+	case "let*":
+		n := len(c.vars)
+		for ; letv(t); t = cdr(t) {
+			c.expr(car(cdr(car(t))), false)
+			c.emit(opSet, c.local(car(car(t))))
+		}
+		c.expr(car(t), tail)
+		c.vars, c.slot = c.vars[:n], c.slot[:n]
+	case "lambda":
+		c.lambda(car(t), car(cdr(t)), nilv)
+	case "define":
+		if x := car(cdr(t)); T(x) == CONS && c.form(car(x)) != nil && c.form(car(x)).s == "lambda" {
+			c.lambda(car(cdr(x)), car(cdr(cdr(x))), car(t))
+		} else {
+			c.expr(x, false)
+		}
+		c.emit(opDefine, c.constant(car(t)))
+	default:
+		c.interpret(cons(atom(f.s), t))
+	}
+}
+
+// lambda emits the creation of a closure, copying the variables it captures
+func (c *compiler) lambda(v, x, name L) {
+	l := compileLambda(v, x, c)
+	l.p.name = name
+	for _, w := range l.free {
+		c.variable(w)
+	}
+	codes = append(codes, l.p)
+	c.emit(opClosure, c.constant(entry(CODE, len(codes))), len(l.free))
+}
+
+// interpret emits code that evaluates x with the interpreter, for special forms
+// the compiler does not know, in an environment of the visible local variables
+func (c *compiler) interpret(x L) {
+	var names []L
+	visible := func(v L) {
+		for _, w := range names {
+			if equ(v, w) {
+				return
+			}
+		}
+		c.variable(v)
+		names = append(names, v)
+	}
+	for p := c; p != nil; p = p.up {
+		for i := len(p.vars) - 1; i >= 0; i-- {
+			visible(p.vars[i])
+		}
+		for _, v := range p.free {
+			visible(v)
+		}
+	}
+	t := nilv
+	for i := len(names) - 1; i >= 0; i-- {
+		t = cons(names[i], t)
+	}
+	c.emit(opEval, c.constant(cons(x, t)), len(names))
+}
+
+// disassemble prints the code of p and of the lambdas it creates
+func disassemble(p *proto) {
+	fmt.Print("; ")
+	printExpr(p.name)
+	fmt.Print(" ")
+	printExpr(p.params)
+	fmt.Printf(" args=%d slots=%d free=%d\n", p.nargs, p.nslots, p.nfree)
+	var inner []*proto
+	for pc := 0; pc < len(p.code); {
+		op := p.code[pc]
+		fmt.Printf("%04d  %-10s", pc, opNames[op])
+		pc++
+		var args []int
+		for i := 0; i < opArgs[op]; i++ {
+			args = append(args, int(binary.LittleEndian.Uint16(p.code[pc:])))
+			fmt.Printf(" %d", args[i])
+			pc += 2
+		}
+		switch op {
+		case opGlobal:
+			fmt.Print("\t; ")
+			printExpr(gnames[args[0]])
+		case opConst, opDefine, opClosure, opEval:
+			fmt.Print("\t; ")
+			printExpr(p.consts[args[0]])
+			if x := p.consts[args[0]]; T(x) == CODE {
+				inner = append(inner, codes[ord(x)])
+			}
+		}
+		fmt.Println()
+	}
+	for _, q := range inner {
+		fmt.Println()
+		disassemble(q)
+	}
+}
+
+// Print the code of a compiled closure, compiling an interpreted one without
+// local variables first
+func f_disassemble(t, e L) L {
+	f := car(t)
+	p := compiled(f)
+	var e2 error
+	if p != nil && p.run != nil && notv(cdr(f)) {
+		e2 = checked(func() { p = compileLambda(p.params, p.body, nil).p })
+	} else if p == nil && T(f) == CLOS && notv(cdr(f)) {
+		e2 = checked(func() { p = compileLambda(car(car(f)), cdr(car(f)), nil).p })
+	}
+	if e2 != nil {
+		return err
+	}
+	if p != nil && p.run != nil {
+		return err
+	}
+	if p == nil {
+		return err
+	}
+	disassemble(p)
+	return tru
+}
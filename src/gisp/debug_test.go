@@ -38,7 +38,7 @@ func TestPrimitiveStorageDebug(t *testing.T) {
 	initTinyLisp()
 	
 	// Check how primitives are stored
-	for name := range prims {
+	for name := range primIndex {
 		sym := atom(name)
 		val := assoc(sym, env)
 		t.Logf("Primitive %s: sym tag=%x ord=%d, val tag=%x ord=%d", 
@@ -62,7 +62,8 @@ func TestApplyDebug(t *testing.T) {
 		
 		// This is what apply() does now
 		primOrd := ord(plusVal)
-		for name, fn := range prims {
+		for _, p := range primTab {
+			name, fn := p.s, p.f
 			if primIndex[name] == primOrd {
 				t.Logf("MATCH FOUND: %s has index %d, matches prim ordinal %d", name, primIndex[name], primOrd)
 				
@@ -0,0 +1,122 @@
+package main
+
+import "math/big"
+
+// Decimal mode: every exact number that is not an integer is rounded to a
+// number of significant decimal digits, so decimal literals such as 0.1 are
+// read exactly and arithmetic gives the results of a decimal calculator.
+// Decimals are exact numbers with a power of ten denominator and print in
+// decimal notation. The mode is selected when the interpreter is set up.
+
+// rounding selects how decimals are rounded to the precision
+type rounding int
+
+const (
+	halfEven rounding = iota // to the nearest, ties to even
+	halfUp                   // to the nearest, ties away from zero
+	halfDown                 // to the nearest, ties toward zero
+	down                     // toward zero
+	up                       // away from zero
+	floor                    // toward negative infinity
+	ceiling                  // toward positive infinity
+)
+
+// Rounding modes by name
+var roundings = map[string]rounding{
+	"half-even": halfEven, "half-up": halfUp, "half-down": halfDown,
+	"down": down, "up": up, "floor": floor, "ceiling": ceiling,
+}
+
+// config holds the choices made when the interpreter is set up
+type config struct {
+	precision int // significant digits of decimals, 0 when not in decimal mode
+	rounding  rounding
+	width     int  // line width of the results the REPL pretty prints, 0 to print them on one line
+	shared    bool // label shared structure in printed expressions, not only cycles
+}
+
+// option changes the configuration of setup
+type option func(*config)
+
+// Configuration of the interpreter
+var conf config
+
+// withDecimal selects decimal mode with precision significant digits rounded by r
+func withDecimal(precision int, r rounding) option {
+	return func(c *config) {
+		c.precision, c.rounding = precision, r
+	}
+}
+
+var ten = big.NewInt(10)
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+}
+
+// magnitude returns k such that 10^(k-1) <= |r| < 10^k for r != 0
+func magnitude(r *big.Rat) int {
+	a := new(big.Rat).Abs(r)
+	k := len(a.Num().String()) - len(a.Denom().String())
+	for a.Cmp(new(big.Rat).SetFrac(pow10(max(k, 0)), pow10(max(-k, 0)))) >= 0 {
+		k++
+	}
+	for k > -1<<20 && a.Cmp(new(big.Rat).SetFrac(pow10(max(k-1, 0)), pow10(max(1-k, 0)))) < 0 {
+		k--
+	}
+	return k
+}
+
+// roundInt rounds r to an integer by mode m
+func roundInt(r *big.Rat, m rounding) *big.Int {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return q
+	}
+	// Twice the remainder compared with the denominator tells where r lies between q and q±1
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	c := half.Cmp(r.Denom())
+	away := false
+	switch m {
+	case halfEven:
+		away = c > 0 || c == 0 && q.Bit(0) == 1
+	case halfUp:
+		away = c >= 0
+	case halfDown:
+		away = c > 0
+	case up:
+		away = true
+	case floor:
+		away = r.Sign() < 0
+	case ceiling:
+		away = r.Sign() > 0
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+	return q
+}
+
+// roundDecimal rounds the non-integer r to the precision of decimal mode
+func roundDecimal(r *big.Rat) *big.Rat {
+	n := conf.precision - magnitude(r)
+	if n >= 0 {
+		s := pow10(n)
+		return new(big.Rat).SetFrac(roundInt(new(big.Rat).Mul(r, new(big.Rat).SetInt(s)), conf.rounding), s)
+	}
+	s := pow10(-n)
+	q := roundInt(new(big.Rat).Quo(r, new(big.Rat).SetInt(s)), conf.rounding)
+	return new(big.Rat).SetInt(q.Mul(q, s))
+}
+
+// formatDecimal returns r in decimal notation if its denominator divides a power of ten
+func formatDecimal(r *big.Rat) string {
+	for n := 0; n <= r.Denom().BitLen(); n++ {
+		if new(big.Int).Rem(pow10(n), r.Denom()).Sign() == 0 {
+			return r.FloatString(n)
+		}
+	}
+	return r.RatString()
+}
@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+// Tests for the decimal mode in decimal.go
+
+// initDecimal resets the interpreter in decimal mode
+func initDecimal(precision int, r rounding) {
+	hp = 0
+	sp = N
+	A = make([]byte, N*8)
+	setup(withDecimal(precision, r))
+}
+
+// show returns number or boolean x as printed
+func show(x L) string {
+	switch {
+	case equ(x, tru):
+		return "#t"
+	case equ(x, nilv):
+		return "()"
+	}
+	return formatNumber(x)
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(+ 0.1 0.2)", "0.3"},
+		{"(= (+ 0.1 0.2) 0.3)", "#t"},
+		{"(/ 1 3)", "0.3333333333"},
+		{"(/ 2 3)", "0.6666666667"},
+		{"(- 0 (/ 2 3))", "-0.6666666667"},
+		{"(* 1.005 100)", "100.5"},
+		{"(/ 10 4)", "2.5"},
+		{"(+ 0.5 0.5)", "1"},
+		{"1e-5", "0.00001"},
+		{"12345.678e2", "1234567.8"},
+		{"(* 99999999999 99999999999)", "9999999999800000000001"},
+		{"(exact? 0.1)", "#t"},
+		{"(exact->inexact 0.1)", "0.1"},
+		{"(/ 1 7000000000000)", "0.0000000000001428571429"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initDecimal(10, halfEven)
+			if got := show(evalAll(tt.input)); got != tt.expected {
+				t.Errorf("%s = %s, want %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecimalRounding(t *testing.T) {
+	inputs := []string{"(/ 25 100)", "(/ 35 100)", "(/ 251 1000)", "(/ -25 100)", "(/ -251 1000)"}
+	tests := []struct {
+		mode     string
+		expected []string
+	}{
+		{"half-even", []string{"0.2", "0.4", "0.3", "-0.2", "-0.3"}},
+		{"half-up", []string{"0.3", "0.4", "0.3", "-0.3", "-0.3"}},
+		{"half-down", []string{"0.2", "0.3", "0.3", "-0.2", "-0.3"}},
+		{"down", []string{"0.2", "0.3", "0.2", "-0.2", "-0.2"}},
+		{"up", []string{"0.3", "0.4", "0.3", "-0.3", "-0.3"}},
+		{"floor", []string{"0.2", "0.3", "0.2", "-0.3", "-0.3"}},
+		{"ceiling", []string{"0.3", "0.4", "0.3", "-0.2", "-0.2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			for i, input := range inputs {
+				initDecimal(1, roundings[tt.mode])
+				if got := show(evalAll(input)); got != tt.expected[i] {
+					t.Errorf("%s = %s, want %s", input, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecimalOff(t *testing.T) {
+	initDecimal(4, halfEven)
+	initTinyLisp()
+	if got := show(evalAll("(/ 1 3)")); got != "1/3" {
+		t.Errorf("(/ 1 3) = %s, want 1/3", got)
+	}
+	if got := show(evalAll("(exact? 0.1)")); got != "()" {
+		t.Errorf("(exact? 0.1) = %s, want ()", got)
+	}
+}
@@ -16,8 +16,7 @@ func TestDefineDebug(t *testing.T) {
 	t.Logf("Are they equal? %v", equ(x1, x2))
 	
 	// Parse and evaluate (define x 42)
-	parser1 := newTestParser("(define x 42)")
-	defineExpr := parser1.readExpr()
+	defineExpr := readOne("(define x 42)")
 	t.Logf("Parsed define expression: tag=%x", T(defineExpr))
 	
 	// Check what x is in the parsed expression
@@ -35,8 +34,7 @@ func TestDefineDebug(t *testing.T) {
 	t.Logf("Looking up x with atom ord=%d: result tag=%x value=%f", ord(x1), T(value), float64(value))
 	
 	// Parse and evaluate just x
-	parser2 := newTestParser("x")
-	varExpr := parser2.readExpr()
+	varExpr := readOne("x")
 	t.Logf("Parsed variable expression: tag=%x ord=%d", T(varExpr), ord(varExpr))
 	
 	result2 := eval(varExpr, env)
@@ -0,0 +1,116 @@
+//go:build float32
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+// Tests for the single precision NaN boxing in nanbox32.go, run with
+// go test -tags float32 -run Float32 .
+
+func TestFloat32Tags(t *testing.T) {
+	initTinyLisp()
+	// The bit patterns of the tags of tinylisp-float.c
+	tests := []struct {
+		name     string
+		x        L
+		expected uint64
+	}{
+		{"ATOM", box(ATOM, 5), 0x7fc00005},
+		{"PRIM", box(PRIM, 5), 0x7fd00005},
+		{"CONS", box(CONS, 5), 0x7fe00005},
+		{"CLOS", box(CLOS, 5), 0x7ff00005},
+		{"NIL", nilv, 0xfff00000},
+	}
+	for _, tt := range tests {
+		if got := pattern(tt.x); got != tt.expected {
+			t.Errorf("%s = %08x, want %08x", tt.name, got, tt.expected)
+		}
+	}
+	if !equ(L(math.NaN()), err) {
+		t.Error("nan should be ERR")
+	}
+	for _, tag := range []I{ATOM, CODE, PRIM, FRAM, CONS, STRG, CLOS, CHAR, VECT, HASH, BIGN, RECD, PORT, FLOT, NIL} {
+		if x := box(tag, maxOrd); T(x) != tag || ord(x) != maxOrd || number(x) {
+			t.Errorf("tag %04x should box ordinal %x as a NaN", tag, maxOrd)
+		}
+	}
+	if n := unsafe.Sizeof(cell); n != N*4 {
+		t.Errorf("cells take %d bytes, want %d", n, N*4)
+	}
+}
+
+func TestFloat32Numbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"16777216", "16777216"},
+		{"(+ 16777216 1)", "16777217"},
+		{"(- (+ 16777216 1) 1)", "16777216"},
+		{"(* 4096 4096)", "16777216"},
+		{"(* 1.1 1.1)", "1.21"},
+		{"(* (/ 1 3) 0.5)", "0.166667"},
+		{"3.14159", "3.14159"},
+		{"1e30", "1e+30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			if got := formatNumber(evalAll(tt.input)); got != tt.expected {
+				t.Errorf("%s = %s, want %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFloat32TableOverflow(t *testing.T) {
+	initTinyLisp()
+	strs = make([]string, maxOrd)
+	if x := str("last"); ord(x) != maxOrd || text(x) != "last" {
+		t.Fatal("the string at the largest ordinal should be boxed")
+	}
+	defer func() {
+		if r := recover(); r != "out of memory" {
+			t.Errorf("a string beyond the largest ordinal should run out of memory, got %v", r)
+		}
+		strs = nil
+	}()
+	str("beyond")
+}
+
+func TestFloat32DotCall(t *testing.T) {
+	content, e := os.ReadFile("../../tests/dotcall.lisp")
+	if e != nil {
+		t.Skip("tests/dotcall.lisp not found")
+	}
+	modes := map[string]func(L) L{
+		"eval":     func(x L) L { return eval(x, env) },
+		"vm":       execTop,
+		"optimize": func(x L) L { return eval(optimize(x), env) },
+	}
+	for name, run := range modes {
+		t.Run(name, func(t *testing.T) {
+			initTinyLisp()
+			passed := 0
+			p := newReader(bytes.NewReader(content))
+			for x, e := p.read(); e == nil; x, e = p.read() {
+				x = run(x)
+				if T(x) == CONS && equ(car(x), atom("passed")) {
+					passed++
+				} else if T(x) == CONS {
+					t.Errorf("dotcall test failed: %v", cdr(x))
+				}
+			}
+			if passed == 0 {
+				t.Error("no dotcall test passed")
+			}
+		})
+	}
+}
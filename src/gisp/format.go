@@ -0,0 +1,387 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Format: (format destination control argument ...) writes control string
+// control with its directives replaced by the arguments they format, to the
+// standard output if the destination is #t, to an output port, or to a string
+// returned if it is (). Nothing is written if the control string is malformed
+// or lacks arguments, which makes ERR. The directives, like those of Common
+// Lisp, take prefix parameters separated by commas, 'c for a character, and
+// the modifiers : and @:
+//
+//	~a ~s            display or write an argument, padded on the right to ~Na, on the left with @
+//	~d ~x ~o ~b      an exact integer in decimal, hexadecimal, octal or binary, padded on
+//	                 the left to ~Nd, with character c to ~N,'cd, with a sign with @
+//	~f               a number in fixed point, ~N,Df in N columns with D digits after the point
+//	~% ~~            a newline or a tilde, ~N% N of them
+//	~{...~}          the text between for each element of a list argument, ~@{ for the
+//	                 remaining arguments and ~:{ for each list of arguments in the list
+//	~^               ends the formatting, or the iteration around it, if no arguments remain
+//	~[...~;...~]     the clause numbered by an argument, or by N in ~N[, the last after ~:;
+//	                 if there is no such clause
+//	~:[...~;...~]    the first clause if the argument is (), the second otherwise
+//	~@[...~]         the clause if the argument is not (), formatting the argument
+//
+// Directives that do not take numbers display other arguments instead. A body
+// of ~{ that formats no arguments is formatted once.
+
+var (
+	errFormat = errors.New("bad format directive")
+	errEscape = errors.New("no more format arguments") // a ~^ ending the formatting
+)
+
+// Bases of the integer directives
+var bases = map[rune]int{'d': 10, 'x': 16, 'o': 8, 'b': 2}
+
+// directive is a directive of a control string
+type directive struct {
+	params    []string // prefix parameters, "" where omitted
+	colon, at bool
+	op        rune
+	end       int // index in the control string after the directive
+}
+
+// directiveAt returns the directive starting with the ~ at s[i]
+func directiveAt(s []rune, i int) (directive, error) {
+	var d directive
+	for i++; ; i++ {
+		j := i
+		if i < len(s) && s[i] == '\'' {
+			i += 2
+		} else {
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || i == j && (s[i] == '-' || s[i] == '+')) {
+				i++
+			}
+		}
+		if i >= len(s) {
+			return d, errFormat
+		}
+		d.params = append(d.params, string(s[j:i]))
+		if s[i] != ',' {
+			break
+		}
+	}
+	for ; i < len(s) && (s[i] == ':' || s[i] == '@'); i++ {
+		if s[i] == ':' {
+			d.colon = true
+		} else {
+			d.at = true
+		}
+	}
+	if i >= len(s) {
+		return d, errFormat
+	}
+	d.op, d.end = unicode.ToLower(s[i]), i+1
+	return d, nil
+}
+
+// param returns numeric parameter i of d, n if it is omitted
+func (d directive) param(i, n int) (int, bool) {
+	if i >= len(d.params) || d.params[i] == "" {
+		return n, true
+	}
+	n, e := strconv.Atoi(d.params[i])
+	return n, e == nil
+}
+
+// padding returns character parameter i of d, a space if it is omitted
+func (d directive) padding(i int) (rune, bool) {
+	if i >= len(d.params) || d.params[i] == "" {
+		return ' ', true
+	} else if p := []rune(d.params[i]); p[0] == '\'' {
+		return p[1], true
+	}
+	return 0, false
+}
+
+// body returns the clauses of the directive opened by op before s[i:], separated
+// by ~; and closed by ~} or ~], with the last separator and the index after the close
+func body(s []rune, i int, op rune) ([][]rune, directive, int, error) {
+	var clauses [][]rune
+	var last directive
+	depth, start := 0, i
+	for i < len(s) {
+		if s[i] != '~' {
+			i++
+			continue
+		}
+		d, e := directiveAt(s, i)
+		if e != nil {
+			return nil, last, 0, e
+		}
+		switch d.op {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth > 0 {
+				depth--
+			} else if op == '{' && d.op == '}' || op == '[' && d.op == ']' {
+				return append(clauses, s[start:i]), last, d.end, nil
+			} else {
+				return nil, last, 0, errFormat
+			}
+		case ';':
+			if depth == 0 {
+				clauses = append(clauses, s[start:i])
+				last, start = d, d.end
+			}
+		}
+		i = d.end
+	}
+	return nil, last, 0, errFormat
+}
+
+// formatter writes a control string with its arguments
+type formatter struct {
+	w    io.Writer
+	args L // arguments not yet formatted
+}
+
+// next returns the next argument
+func (f *formatter) next() (L, error) {
+	if T(f.args) != CONS {
+		return err, errFormat
+	}
+	x := car(f.args)
+	f.args = cdr(f.args)
+	return x, nil
+}
+
+// pad writes s padded with c to n characters, on the left if left
+func (f *formatter) pad(s string, n int, c rune, left bool) {
+	fill := strings.Repeat(string(c), max(0, n-utf8.RuneCountInString(s)))
+	if left {
+		s = fill + s
+	} else {
+		s += fill
+	}
+	io.WriteString(f.w, s)
+}
+
+// format writes control string s
+func (f *formatter) format(s []rune) error {
+	for i := 0; i < len(s); {
+		if s[i] != '~' {
+			j := i
+			for j < len(s) && s[j] != '~' {
+				j++
+			}
+			io.WriteString(f.w, string(s[i:j]))
+			i = j
+			continue
+		}
+		d, e := directiveAt(s, i)
+		if e != nil {
+			return e
+		}
+		i = d.end
+		switch d.op {
+		case '{', '[':
+			clauses, last, end, e := body(s, i, d.op)
+			if e != nil {
+				return e
+			}
+			i = end
+			if d.op == '[' {
+				e = f.choose(d, clauses, last)
+			} else if len(clauses) == 1 {
+				e = f.iterate(d, clauses[0])
+			} else {
+				e = errFormat
+			}
+			if e != nil {
+				return e
+			}
+		default:
+			if e := f.directive(d); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// directive writes a directive other than ~{ and ~[
+func (f *formatter) directive(d directive) error {
+	n, ok := d.param(0, 0)
+	if !ok {
+		return errFormat
+	}
+	switch d.op {
+	case 'a', 's':
+		x, e := f.next()
+		if e != nil {
+			return e
+		}
+		var b strings.Builder
+		output(&b, x, d.op == 'a')
+		f.pad(b.String(), n, ' ', d.at)
+	case 'd', 'x', 'o', 'b':
+		x, e := f.next()
+		c, ok := d.padding(1)
+		if e != nil || !ok {
+			return errFormat
+		}
+		f.pad(radix(x, bases[d.op], d.at), n, c, true)
+	case 'f':
+		x, e := f.next()
+		digits, ok := d.param(1, -1)
+		if e != nil || !ok {
+			return errFormat
+		}
+		f.pad(fixed(x, digits, d.at), n, ' ', true)
+	case '%', '~':
+		if n, _ = d.param(0, 1); d.op == '%' {
+			io.WriteString(f.w, strings.Repeat("\n", n))
+		} else {
+			io.WriteString(f.w, strings.Repeat("~", n))
+		}
+	case '^':
+		if T(f.args) != CONS {
+			return errEscape
+		}
+	default:
+		return errFormat
+	}
+	return nil
+}
+
+// iterate writes body s for each element of the list argument, or of the
+// remaining arguments with @
+func (f *formatter) iterate(d directive, s []rune) error {
+	t := f.args
+	if !d.at {
+		x, e := f.next()
+		if e != nil {
+			return e
+		}
+		t = x
+	}
+	for T(t) == CONS {
+		g := &formatter{f.w, t}
+		if d.colon {
+			g.args = car(t)
+		}
+		if e := g.format(s); e != nil && !errors.Is(e, errEscape) {
+			return e
+		}
+		if d.colon {
+			t = cdr(t)
+		} else if equ(g.args, t) {
+			break
+		} else {
+			t = g.args
+		}
+	}
+	if d.at {
+		f.args = t
+	}
+	return nil
+}
+
+// choose writes the clause of conditional d chosen by its argument
+func (f *formatter) choose(d directive, clauses [][]rune, last directive) error {
+	switch {
+	case d.colon:
+		x, e := f.next()
+		if e != nil || len(clauses) != 2 {
+			return errFormat
+		} else if notv(x) {
+			return f.format(clauses[0])
+		}
+		return f.format(clauses[1])
+	case d.at:
+		if len(clauses) != 1 || T(f.args) != CONS {
+			return errFormat
+		} else if notv(car(f.args)) {
+			f.args = cdr(f.args)
+			return nil
+		}
+		return f.format(clauses[0])
+	}
+	n, ok := d.param(0, -1)
+	if !ok {
+		return errFormat
+	} else if n < 0 {
+		x, e := f.next()
+		if e != nil || !small(x) {
+			return errFormat
+		}
+		n = int(x)
+	}
+	if n >= 0 && n < len(clauses) {
+		return f.format(clauses[n])
+	} else if last.colon {
+		return f.format(clauses[len(clauses)-1])
+	}
+	return nil
+}
+
+// display returns x in display mode
+func display(x L) string {
+	var b strings.Builder
+	fdisplayExpr(&b, x)
+	return b.String()
+}
+
+// radix returns exact integer x in base b, with a sign if sign, or x displayed
+// if it is not an exact integer
+func radix(x L, b int, sign bool) string {
+	n, ok := integer(x)
+	if !ok {
+		return display(x)
+	} else if sign && n.Sign() >= 0 {
+		return "+" + n.Text(b)
+	}
+	return n.Text(b)
+}
+
+// fixed returns number x in fixed point with digits after the point, or with
+// as few as read back as x if digits is negative, with a sign if sign; x
+// displayed if it is not a number
+func fixed(x L, digits int, sign bool) string {
+	if !numeric(x) {
+		return display(x)
+	}
+	var s string
+	if r, ok := exact(x); ok && digits >= 0 {
+		s = r.FloatString(digits)
+	} else if s = strconv.FormatFloat(inexact(x), 'f', digits, floatBits); digits < 0 && !strings.ContainsAny(s, ".IN") {
+		s += ".0"
+	}
+	if sign && s[0] != '-' && s[0] != '+' {
+		s = "+" + s
+	}
+	return s
+}
+
+// Write the arguments formatted by a control string to the standard output if
+// the destination is #t, to a port, or to a string returned if it is ()
+func f_format(t, e L) L {
+	dest, control := car(t), car(cdr(t))
+	if T(control) != STRG || !notv(dest) && !equ(dest, tru) && T(dest) != PORT {
+		return err
+	}
+	var b strings.Builder
+	f := &formatter{&b, cdr(cdr(t))}
+	if e2 := f.format([]rune(text(control))); e2 != nil && !errors.Is(e2, errEscape) {
+		return err
+	}
+	switch {
+	case notv(dest):
+		return str(b.String())
+	case T(dest) == PORT:
+		io.WriteString(portOf(dest), b.String())
+	default:
+		io.WriteString(standard, b.String())
+	}
+	return nilv
+}
@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+// Tests for the format primitive
+
+func TestFormatDirectives(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(format () "x = ~a, s = ~s" "hi" "hi")`, `x = hi, s = "hi"`},
+		{`(format () "~5a|~5@a|" 'ab '(1))`, "ab   |  (1)|"},
+		{`(format () "~5d|~5,'0d|~@d|~d" 42 7 3 'x)`, "   42|00007|+3|x"},
+		{`(format () "~x ~o ~b ~d" 255 8 5 12345678901234567890123)`, "ff 10 101 12345678901234567890123"},
+		{`(format () "~8,3f|~f|~,2f|~f|~@f" 3.14159 2 1/3 2.5 1)`, "   3.142|2.0|0.33|2.5|+1.0"},
+		{`(format () "a~%b~2%~~")`, "a\nb\n\n~"},
+		{`(format () "~{~a~^, ~}." '(1 2 3))`, "1, 2, 3."},
+		{`(format () "~{~a=~a ~}" '(a 1 b 2))`, "a=1 b=2 "},
+		{`(format () "~:{(~a ~a)~}" '((a 1) (b 2)))`, "(a 1)(b 2)"},
+		{`(format () "~@{<~a>~}" 1 2 3)`, "<1><2><3>"},
+		{`(format () "~:[no~;yes~] ~:[no~;yes~]" () #t)`, "no yes"},
+		{`(format () "~[zero~;one~:;many~] ~[zero~;one~:;many~] ~1[a~;b~]" 0 7)`, "zero many b"},
+		{`(format () "~@[x=~a ~]~@[y=~a~]" () 5)`, "y=5"},
+		{`(format () "~{~a~[ ~;!~]~}" '(a 0 b 1))`, "a b!"},
+		{`(format () "done~^ ~a")`, "done"},
+	}
+	for _, tt := range tests {
+		initTinyLisp()
+		if x := evalAll(tt.input); T(x) != STRG || text(x) != tt.expected {
+			t.Errorf("%s = %s, want %q", tt.input, printed(x), tt.expected)
+		}
+	}
+}
+
+func TestFormatDestinations(t *testing.T) {
+	initTinyLisp()
+	var result L
+	if out := stdout(func() { result = evalAll(`(format #t "hello ~a~%" 'world)`) }); out != "hello world\n" || !notv(result) {
+		t.Errorf("format to #t wrote %q and returned %s", out, printed(result))
+	}
+	x := evalAll(`(define p (open-output-string)) (format p "~a-" 1) (format p "~s" "q") (get-output-string p)`)
+	if T(x) != STRG || text(x) != `1-"q"` {
+		t.Errorf("format to a string port wrote %s", printed(x))
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	for _, input := range []string{
+		`(format () "~a")`,
+		`(format () "~q" 1)`,
+		`(format () "~{~a" '(1))`,
+		`(format () "~a~}" 1)`,
+		`(format () "~:[a~]" 1)`,
+		`(format () "~x" )`,
+		`(format 'x "a")`,
+		`(format () 'a)`,
+	} {
+		initTinyLisp()
+		if out := stdout(func() {
+			if x := evalAll(input); !equ(x, err) {
+				t.Errorf("%s = %s, want ERR", input, printed(x))
+			}
+		}); out != "" {
+			t.Errorf("%s wrote %q", input, out)
+		}
+	}
+	initTinyLisp()
+	if out := stdout(func() { evalAll(`(format #t "a ~a ~a" 1)`) }); out != "" {
+		t.Errorf("format should write nothing when arguments are missing, wrote %q", out)
+	}
+}
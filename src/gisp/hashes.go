@@ -0,0 +1,225 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Hash tables: boxed with the HASH tag, indexing the hashes table. Keys are
+// compared like eq?, except strings which are compared by their text, or with
+// equal? when the table is made with (make-hash-table 'equal).
+
+// table is a hash table, keeping its entries in insertion order
+type table struct {
+	equal bool
+	index map[string]int // position in keys and vals of each hashed key
+	keys  []L
+	vals  []L
+}
+
+// Hash tables by index, and the number of tables after the latest define
+var (
+	hashes  []*table
+	hashtop int
+)
+
+// hashOf returns the table of hash table x
+func hashOf(x L) *table {
+	return hashes[ord(x)]
+}
+
+// numberKey returns the key of number x: the double it holds, or the ratio of a
+// big integer or ratio that no double holds, so that numbers of the same value,
+// which eq? and equal? compare equal, have the same key
+func numberKey(x L) string {
+	if T(x) == BIGN {
+		if _, ok := bigs[ord(x)].Float64(); !ok {
+			return bigs[ord(x)].RatString()
+		}
+	}
+	f := inexact(x)
+	if f == 0 {
+		f = 0 // -0 is 0
+	}
+	return strconv.FormatFloat(f, 'x', -1, 64)
+}
+
+// hashKey writes the key under which x is stored to b, descending into lists
+// and vectors if structural
+func hashKey(b *strings.Builder, x L, structural bool) {
+	switch {
+	case T(x) == STRG:
+		b.WriteString(strconv.Quote(text(x)))
+	case numeric(x):
+		b.WriteString(numberKey(x))
+	case T(x) == CONS && structural:
+		b.WriteByte('(')
+		hashKey(b, car(x), true)
+		b.WriteByte(' ')
+		hashKey(b, cdr(x), true)
+		b.WriteByte(')')
+	case T(x) == VECT && structural:
+		b.WriteByte('[')
+		for i := 1; i <= vlen(x); i++ {
+			hashKey(b, cell[ord(x)+I(i)], true)
+			b.WriteByte(' ')
+		}
+		b.WriteByte(']')
+	default:
+		b.WriteString(strconv.FormatUint(pattern(x), 16))
+	}
+}
+
+// key returns the key under which x is stored in h
+func (h *table) key(x L) string {
+	var b strings.Builder
+	hashKey(&b, x, h.equal)
+	return b.String()
+}
+
+// set binds key k to x
+func (h *table) set(k, x L) {
+	s := h.key(k)
+	if i, ok := h.index[s]; ok {
+		h.vals[i] = x
+		return
+	}
+	h.index[s] = len(h.keys)
+	h.keys = append(h.keys, k)
+	h.vals = append(h.vals, x)
+}
+
+// remove deletes key k, moving the last entry into its place
+func (h *table) remove(k L) bool {
+	s := h.key(k)
+	i, ok := h.index[s]
+	if !ok {
+		return false
+	}
+	last := len(h.keys) - 1
+	h.index[h.key(h.keys[last])] = i
+	h.keys[i], h.vals[i] = h.keys[last], h.vals[last]
+	h.keys, h.vals = h.keys[:last], h.vals[:last]
+	delete(h.index, s)
+	return true
+}
+
+// equal reports whether x and y are eq?, equal numbers or have equal text or elements
+func equal(x, y L) bool {
+	switch {
+	case numeric(x) && numeric(y):
+		return compareNumbers(x, y) == 0
+	case T(x) == CONS && T(y) == CONS:
+		return equal(car(x), car(y)) && equal(cdr(x), cdr(y))
+	case T(x) == STRG && T(y) == STRG:
+		return text(x) == text(y)
+	case T(x) == VECT && T(y) == VECT:
+		if vlen(x) != vlen(y) {
+			return false
+		}
+		for i := 1; i <= vlen(x); i++ {
+			if !equal(cell[ord(x)+I(i)], cell[ord(y)+I(i)]) {
+				return false
+			}
+		}
+		return true
+	}
+	return equ(x, y)
+}
+
+// Return #t if the arguments are structurally equal
+func f_equal(t, e L) L {
+	if equal(car(t), car(cdr(t))) {
+		return tru
+	}
+	return nilv
+}
+
+// Make an empty hash table, comparing keys with equal? if the argument is equal or equal?
+func f_make_hash_table(t, e L) L {
+	h := &table{index: make(map[string]int)}
+	if m := car(t); T(t) == CONS && (equ(m, atom("equal")) || equ(m, atom("equal?"))) {
+		h.equal = true
+	} else if T(t) == CONS {
+		return err
+	}
+	hashes = append(hashes, h)
+	return entry(HASH, len(hashes))
+}
+
+// Return #t if the argument is a hash table
+func f_hash_tablep(t, e L) L {
+	if T(car(t)) == HASH {
+		return tru
+	}
+	return nilv
+}
+
+// Return the value of a key, or the optional default or ERR if the key is absent
+func f_hash_ref(t, e L) L {
+	if T(car(t)) != HASH {
+		return err
+	}
+	h := hashOf(car(t))
+	if i, ok := h.index[h.key(car(cdr(t)))]; ok {
+		return h.vals[i]
+	}
+	if d := cdr(cdr(t)); T(d) == CONS {
+		return car(d)
+	}
+	return err
+}
+
+// Bind a key to a value, returning the value
+func f_hash_set(t, e L) L {
+	if T(car(t)) != HASH {
+		return err
+	}
+	hashOf(car(t)).set(car(cdr(t)), car(cdr(cdr(t))))
+	retain(car(cdr(t)))
+	retain(car(cdr(cdr(t))))
+	return car(cdr(cdr(t)))
+}
+
+// Remove a key, returning #t if it was present
+func f_hash_remove(t, e L) L {
+	if T(car(t)) != HASH {
+		return err
+	}
+	if hashOf(car(t)).remove(car(cdr(t))) {
+		return tru
+	}
+	return nilv
+}
+
+// Return the list of keys
+func f_hash_keys(t, e L) L {
+	if T(car(t)) != HASH {
+		return err
+	}
+	return listOf(hashOf(car(t)).keys)
+}
+
+// Return the number of keys
+func f_hash_count(t, e L) L {
+	if T(car(t)) != HASH {
+		return err
+	}
+	return L(len(hashOf(car(t)).keys))
+}
+
+// Apply a function to each key and value, returning ()
+func f_hash_for_each(t, e L) L {
+	f, x := car(t), car(cdr(t))
+	if T(x) != HASH {
+		return err
+	}
+	h := hashOf(x)
+	keys := append([]L(nil), h.keys...)
+	for _, k := range keys {
+		if i, ok := h.index[h.key(k)]; ok {
+			invoke(f, cons(k, cons(h.vals[i], nilv)))
+		}
+	}
+	return nilv
+}
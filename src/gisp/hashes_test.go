@@ -0,0 +1,109 @@
+package main
+
+import "testing"
+
+// Tests for the hash tables in hashes.go
+
+func TestHashTables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected L
+	}{
+		{"(hash-ref h 'a)", 1},
+		{`(hash-ref h "b")`, 2},
+		{"(hash-ref h 3)", 4},
+		{"(hash-ref h 'missing)", err},
+		{"(hash-ref h 'missing 0)", 0},
+		{"(hash-ref h '(1 2) 0)", 0},
+		{"(hash-count h)", 4},
+		{"(hash-count (make-hash-table))", 0},
+		{"(let* (_ (hash-set! h 'a 5)) (+ (hash-ref h 'a) (hash-count h)))", 9},
+		{"(let* (_ (hash-remove! h 'a)) (hash-ref h 'a ()))", nilv},
+		{"(hash-remove! h 'missing)", nilv},
+		{"(car (cdr (hash-keys h)))", 3},
+		{"(hash-table? h)", tru},
+		{"(hash-table? '(a . 1))", nilv},
+		{"(make-hash-table 'eq)", err},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			evalAll(`(define h (make-hash-table)) (hash-set! h 'a 1) (hash-set! h 'c 3) (hash-set! h "b" 2) (hash-set! h 3 4) (hash-remove! h 'c)
+				(hash-set! h 'c 3)`)
+			if result := evalAll(tt.input); !equ(result, tt.expected) {
+				t.Errorf("%s = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHashEqualMode(t *testing.T) {
+	initTinyLisp()
+	evalAll(`(define h (make-hash-table 'equal)) (hash-set! h '(1 "a" #(2 3)) 'found)`)
+	if result := evalAll(`(hash-ref h '(1 "a" #(2 3)))`); !equ(result, atom("found")) {
+		t.Error("a table made with 'equal should find a structurally equal key")
+	}
+	if result := evalAll(`(hash-ref h '(1 "a" #(2 4)) ())`); !notv(result) {
+		t.Error("a table made with 'equal should not find a different key")
+	}
+	if result := evalAll(`(equal? '(1 "a" #(2 3)) '(1 "a" #(2 3)))`); !equ(result, tru) {
+		t.Error("equal? should compare lists, strings and vectors structurally")
+	}
+}
+
+func TestHashNumberKeys(t *testing.T) {
+	tests := []struct {
+		x, y string
+		same bool
+	}{
+		{"(/ 1 2)", "0.5", true},
+		{"2", "(exact->inexact 2)", true},
+		{"4294967296", "4294967296.0", true},
+		{"-0.0", "0", true},
+		{"9007199254740993", "9007199254740992.0", false},
+		{"(/ 1 3)", "(/ 1.0 3)", false},
+		{"1", "'a", false},
+	}
+	for _, tt := range tests {
+		for _, mode := range []string{"", "'equal"} {
+			initTinyLisp()
+			evalAll("(define h (make-hash-table " + mode + ")) (hash-set! h " + tt.x + " 'found)")
+			if found := !notv(evalAll("(hash-ref h " + tt.y + " ())")); found != tt.same {
+				t.Errorf("(hash-ref h %s) after setting %s found %v, want %v", tt.y, tt.x, found, tt.same)
+			}
+			if eq := !notv(evalAll("(eq? " + tt.x + " " + tt.y + ")")); eq != tt.same {
+				t.Errorf("(eq? %s %s) = %v, want %v", tt.x, tt.y, eq, tt.same)
+			}
+		}
+	}
+}
+
+func TestHashForEach(t *testing.T) {
+	initTinyLisp()
+	result := evalAll(`
+		(define h (make-hash-table))
+		(hash-set! h 'a 1)
+		(hash-set! h 'b 2)
+		(define sum (make-vector 1 0))
+		(hash-for-each (lambda (k v) (vector-set! sum 0 (+ v (vector-ref sum 0)))) h)
+		(vector-ref sum 0)`)
+	if !equ(result, L(3)) {
+		t.Errorf("sum of values with hash-for-each = %v, want 3", result)
+	}
+}
+
+func TestHashGC(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define h (make-hash-table))")
+	gc()
+	evalAll("(hash-set! h 'k '(a b))")
+	evalAll("(make-hash-table)")
+	gc()
+	if len(hashes) != 1 {
+		t.Errorf("gc kept %d tables, want 1", len(hashes))
+	}
+	if x := evalAll("(hash-ref h 'k)"); !equal(x, readOne("(a b)")) {
+		t.Error("gc should keep a list stored in a table")
+	}
+}
@@ -1,167 +1,14 @@
 package main
 
 import (
-	"strings"
 	"testing"
 )
 
 // Integration tests that test complete Lisp expressions from parsing to evaluation
 
-// Test-safe parser that handles EOF gracefully
-type testParser struct {
-	input string
-	pos   int
-	ch    byte
-}
-
-func newTestParser(input string) *testParser {
-	p := &testParser{input: input, pos: 0}
-	p.next()
-	return p
-}
-
-func (p *testParser) next() {
-	if p.pos < len(p.input) {
-		p.ch = p.input[p.pos]
-		p.pos++
-	} else {
-		p.ch = 0 // EOF
-	}
-}
-
-func (p *testParser) skipWhitespace() {
-	for p.ch > 0 && p.ch <= ' ' {
-		p.next()
-	}
-}
-
-func (p *testParser) readAtom() L {
-	start := p.pos - 1  // Start at current character position
-	// Keep reading while we have valid atom characters
-	for p.ch > ' ' && p.ch != '(' && p.ch != ')' && p.ch != '\'' && p.ch != 0 {
-		p.next()
-	}
-	// Extract the atom string - end is where we stopped
-	end := p.pos
-	if p.ch != 0 {
-		end = p.pos - 1  // Back up one if we stopped on a delimiter
-	}
-	s := p.input[start:end]
-	
-	// Try to parse as number
-	if len(s) > 0 {
-		// Simple number parsing
-		var val float64
-		var isNum bool
-		if s == "0" {
-			val = 0
-			isNum = true
-		} else {
-			// Parse float manually since we can't use strconv easily
-			sign := 1.0
-			i := 0
-			if s[0] == '-' {
-				sign = -1
-				i = 1
-			} else if s[0] == '+' {
-				i = 1
-			}
-			
-			// Check if it's all digits or has decimal point
-			hasDigit := false
-			hasDot := false
-			for j := i; j < len(s); j++ {
-				if s[j] >= '0' && s[j] <= '9' {
-					hasDigit = true
-				} else if s[j] == '.' && !hasDot {
-					hasDot = true
-				} else {
-					goto notNumber // Contains invalid character
-				}
-			}
-			
-			if hasDigit {
-				// Simple integer parsing
-				for j := i; j < len(s) && s[j] != '.'; j++ {
-					val = val*10 + float64(s[j]-'0')
-				}
-				
-				// Handle decimal part
-				if hasDot {
-					factor := 0.1
-					dotPos := strings.IndexByte(s[i:], '.')
-					if dotPos >= 0 {
-						for j := i + dotPos + 1; j < len(s); j++ {
-							val += float64(s[j]-'0') * factor
-							factor *= 0.1
-						}
-					}
-				}
-				
-				val *= sign
-				isNum = true
-			}
-		}
-		
-		notNumber:
-		if isNum {
-			return L(val)
-		}
-	}
-	
-	// Return as atom
-	return atom(s)
-}
-
-func (p *testParser) readList() L {
-	p.skipWhitespace()
-	if p.ch == ')' {
-		p.next()
-		return nilv
-	}
-	if p.ch == 0 {
-		return nilv
-	}
-	
-	// Handle dot notation
-	if p.ch == '.' {
-		p.next()
-		p.skipWhitespace()
-		result := p.readExpr()
-		p.skipWhitespace()
-		if p.ch == ')' {
-			p.next()
-		}
-		return result
-	}
-	
-	first := p.readExpr()
-	rest := p.readList()
-	return cons(first, rest)
-}
-
-func (p *testParser) readExpr() L {
-	p.skipWhitespace()
-	
-	switch p.ch {
-	case 0:
-		return nilv
-	case '(':
-		p.next()
-		return p.readList()
-	case '\'':
-		p.next()
-		return cons(atom("quote"), cons(p.readExpr(), nilv))
-	default:
-		return p.readAtom()
-	}
-}
-
 func parseAndEval(input string) L {
 	initTinyLisp()
-	parser := newTestParser(input)
-	expr := parser.readExpr()
-	return eval(expr, env)
+	return eval(readOne(input), env)
 }
 
 func TestBasicArithmetic(t *testing.T) {
@@ -408,13 +255,11 @@ func TestVariableBinding(t *testing.T) {
 		initTinyLisp()
 		
 		// Define x = 42
-		parser1 := newTestParser("(define x 42)")
-		defineExpr := parser1.readExpr()
+		defineExpr := readOne("(define x 42)")
 		eval(defineExpr, env)
 		
 		// Now evaluate x
-		parser2 := newTestParser("x")
-		varExpr := parser2.readExpr()
+		varExpr := readOne("x")
 		result := eval(varExpr, env)
 		
 		if !equ(result, L(42)) {
@@ -478,14 +323,12 @@ func TestComplexIntegration(t *testing.T) {
 		initTinyLisp()
 		
 		input1 := "(define square (lambda (x) (* x x)))"
-		parser1 := newTestParser(input1)
-		expr1 := parser1.readExpr()
+		expr1 := readOne(input1)
 		eval(expr1, env)
 		
 		// Now use it: (square 5) should be 25
 		input2 := "(square 5)"
-		parser2 := newTestParser(input2)
-		expr2 := parser2.readExpr()
+		expr2 := readOne(input2)
 		result := eval(expr2, env)
 		
 		if !equ(result, L(25)) {
@@ -567,14 +410,12 @@ func TestDotCallCompatibility(t *testing.T) {
 			
 			// Run setup expressions
 			for _, setup := range tt.setup {
-				parser := newTestParser(setup)
-				expr := parser.readExpr()
+				expr := readOne(setup)
 				eval(expr, env)
 			}
 			
 			// Run test expression
-			parser := newTestParser(tt.input)
-			expr := parser.readExpr()
+			expr := readOne(tt.input)
 			result := eval(expr, env)
 			
 			if !tt.checkFn(result) {
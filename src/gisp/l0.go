@@ -2,51 +2,32 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"math"
+	"math/big"
 	"os"
-	"strconv"
 )
 
-// NaN boxing constants
-const (
-	ATOM = 0x7ff8
-	PRIM = 0x7ff9
-	CONS = 0x7ffa
-	CLOS = 0x7ffb
-	NIL  = 0x7ffc
-	N    = 32767
-)
-
-type L float64
-type I uint64
+// Number of cells
+const N = 32767
 
 var (
 	cell [N]L
 	hp   I = 0
 	sp   I = N
-	A      = make([]byte, N*8)
+	A      = make([]byte, N*cellSize)
 	nilv L
 	tru  L
 	err  L
-	env  L
+	env  L // the global environment, ending every list of local bindings
+	top  I // sp after the latest define, cells below it hold global values
 )
 
-// NaN boxing helpers
-func box(t, i I) L {
-	return L(math.Float64frombits(uint64(t)<<48 | uint64(i)))
-}
-
-func T(x L) I {
-	return I(math.Float64bits(float64(x)) >> 48)
-}
-
-func ord(x L) I {
-	return I(math.Float64bits(float64(x)) & 0xFFFFFFFFFFFF)
-}
-
 func equ(x, y L) bool {
-	return math.Float64bits(float64(x)) == math.Float64bits(float64(y))
+	return pattern(x) == pattern(y)
 }
 
 func ifv(cond L, alt L) L {
@@ -66,10 +47,9 @@ func bind(v, t, e L) L {
 }
 
 func eval(x, e L) L {
-	if T(x) == ATOM {
-		return assoc(x, e)
-	} else if T(x) == CONS {
-		return apply(eval(car(x), e), cdr(x), e)
+	if T(x) == ATOM || T(x) == CONS {
+		f := frameOf(e)
+		return analyze(x, scopeOf(f))(f)
 	}
 	return x
 }
@@ -94,7 +74,7 @@ func atom(s string) L {
 	A[hp+I(len(s))] = 0
 	result := box(ATOM, hp)
 	hp += I(len(s) + 1)
-	if hp > sp<<3 {
+	if hp > sp*cellSize {
 		panic("out of memory")
 	}
 	return result
@@ -105,7 +85,7 @@ func cons(x, y L) L {
 	cell[sp-1] = x
 	cell[sp-2] = y
 	sp -= 2
-	if hp > sp<<3 {
+	if hp > sp*cellSize {
 		panic("out of memory")
 	}
 	return box(CONS, sp)
@@ -145,9 +125,46 @@ func assoc(v, e L) L {
 	if T(e) == CONS {
 		return cdr(car(e))
 	}
+	if i, ok := gslots[ord(v)]; ok && T(v) == ATOM {
+		return globals[i]
+	}
 	return err
 }
 
+// Global variables by slot, the atom of each slot, the slots defined as
+// constants and the slot of each atom
+var (
+	globals []L
+	gnames  []L
+	gconst  []bool
+	gslots  map[I]int
+)
+
+// global returns the slot of atom v in globals, adding an unbound slot if needed
+func global(v L) int {
+	if i, ok := gslots[ord(v)]; ok {
+		return i
+	}
+	gslots[ord(v)] = len(globals)
+	globals = append(globals, err)
+	gnames = append(gnames, v)
+	gconst = append(gconst, false)
+	return len(globals) - 1
+}
+
+// define binds v to x in the global environment, replacing any previous value;
+// replacing a primitive invalidates the calls of it resolved by the analyzer
+func define(v, x L) {
+	if T(v) == ATOM {
+		if T(globals[global(v)]) == PRIM {
+			rebound++
+		}
+		globals[global(v)] = x
+		gconst[global(v)] = false
+		retain(x)
+	}
+}
+
 // not and let
 func notv(x L) bool {
 	return T(x) == NIL
@@ -164,67 +181,63 @@ func evlis(t, e L) L {
 	if T(t) == CONS {
 		return cons(eval(car(t), e), evlis(cdr(t), e))
 	} else if T(t) == ATOM {
-		return assoc(t, e)
+		return eval(t, e)
 	}
 	return nilv
 }
 
-// Primitives
+// Primitives, called with evaluated arguments unless they are special forms
 func f_add(t, e L) L {
-	t = evlis(t, e)
 	n := car(t)
 	for {
 		t = cdr(t)
 		if notv(t) {
 			break
 		}
-		n += car(t)
+		n = arith('+', n, car(t))
 	}
 	return n
 }
 
 func f_sub(t, e L) L {
-	t = evlis(t, e)
 	n := car(t)
 	for {
 		t = cdr(t)
 		if notv(t) {
 			break
 		}
-		n -= car(t)
+		n = arith('-', n, car(t))
 	}
 	return n
 }
 
 func f_mul(t, e L) L {
-	t = evlis(t, e)
 	n := car(t)
 	for {
 		t = cdr(t)
 		if notv(t) {
 			break
 		}
-		n *= car(t)
+		n = arith('*', n, car(t))
 	}
 	return n
 }
 
 func f_div(t, e L) L {
-	t = evlis(t, e)
 	n := car(t)
 	for {
 		t = cdr(t)
 		if notv(t) {
 			break
 		}
-		n /= car(t)
+		n = arith('/', n, car(t))
 	}
 	return n
 }
 
 // Additional primitives
 func f_eval(t, e L) L {
-	return eval(car(evlis(t, e)), e)
+	return eval(car(t), e)
 }
 
 func f_quote(t, e L) L {
@@ -232,44 +245,69 @@ func f_quote(t, e L) L {
 }
 
 func f_cons(t, e L) L {
-	t = evlis(t, e)
 	return cons(car(t), car(cdr(t)))
 }
 
 func f_car(t, e L) L {
-	return car(car(evlis(t, e)))
+	return car(car(t))
 }
 
 func f_cdr(t, e L) L {
-	return cdr(car(evlis(t, e)))
+	return cdr(car(t))
+}
+
+// Replace the car of a pair, returning the new car
+func f_set_car(t, e L) L {
+	if T(car(t)) != CONS {
+		return err
+	}
+	cell[ord(car(t))+1] = car(cdr(t))
+	retain(car(cdr(t)))
+	return car(cdr(t))
+}
+
+// Replace the cdr of a pair, returning the new cdr
+func f_set_cdr(t, e L) L {
+	if T(car(t)) != CONS {
+		return err
+	}
+	cell[ord(car(t))] = car(cdr(t))
+	retain(car(cdr(t)))
+	return car(cdr(t))
 }
 
 func f_int(t, e L) L {
-	n := car(evlis(t, e))
-	if n < 1e16 && n > -1e16 {
-		return L(int64(n))
+	n := car(t)
+	if r, ok := exact(n); ok {
+		return rat(new(big.Rat).SetInt(new(big.Int).Quo(r.Num(), r.Denom())))
+	} else if numeric(n) && !math.IsInf(inexact(n), 0) {
+		return rat(new(big.Rat).SetFloat64(math.Trunc(inexact(n))))
 	}
 	return n
 }
 
 func f_lt(t, e L) L {
-	t = evlis(t, e)
-	if car(t)-car(cdr(t)) < 0 {
+	if !numeric(car(t)) || !numeric(car(cdr(t))) {
+		return err
+	}
+	if compareNumbers(car(t), car(cdr(t))) < 0 {
 		return tru
 	}
 	return nilv
 }
 
+// eq? compares numbers by value, as tinylisp does with its numbers that are all
+// doubles, so that exact and boxed numbers are eq? to the numbers they equal
 func f_eq(t, e L) L {
-	t = evlis(t, e)
-	if equ(car(t), car(cdr(t))) {
+	x, y := car(t), car(cdr(t))
+	if equ(x, y) || numeric(x) && numeric(y) && compareNumbers(x, y) == 0 {
 		return tru
 	}
 	return nilv
 }
 
 func f_pair(t, e L) L {
-	x := car(evlis(t, e))
+	x := car(t)
 	if T(x) == CONS {
 		return tru
 	}
@@ -301,7 +339,7 @@ func f_and(t, e L) L {
 }
 
 func f_not(t, e L) L {
-	if notv(car(evlis(t, e))) {
+	if notv(car(t)) {
 		return tru
 	}
 	return nilv
@@ -334,10 +372,40 @@ func f_lambda(t, e L) L {
 }
 
 func f_define(t, e L) L {
-	env = pair(car(t), eval(car(cdr(t)), e), env)
+	define(car(t), eval(car(cdr(t)), e))
 	return car(t)
 }
 
+// Define a global the optimizer may assume never changes
+func f_define_constant(t, e L) L {
+	define(car(t), eval(car(cdr(t)), e))
+	if T(car(t)) == ATOM {
+		gconst[global(car(t))] = true
+	}
+	return car(t)
+}
+
+// Optimize an expression without evaluating it
+func f_optimize(t, e L) L {
+	return optimize(car(t))
+}
+
+// List the bound global variables as (name . value) pairs in the order they were first defined
+func f_bindings(t, e L) L {
+	var xs []L
+	for i, x := range globals {
+		if !equ(x, err) {
+			xs = append(xs, cons(gnames[i], x))
+		}
+	}
+	return listOf(xs)
+}
+
+// run evaluates a top-level expression in the global environment
+var run = func(x L) L {
+	return eval(x, env)
+}
+
 // Load Lisp code from a file
 func loadFile(filename string, _ L) L {
 	content, err := os.ReadFile(filename)
@@ -345,23 +413,22 @@ func loadFile(filename string, _ L) L {
 		return atom("FILE-ERROR")
 	}
 
-	input := string(content)
-	parser := newInputParser(input)
+	parser := newReader(bytes.NewReader(content))
+	parser.file = filename
 	var result L = nilv
 
-	// Parse and evaluate each expression in the file
-	for parser.ch != 0 {
-		parser.skipWhitespace()
-		if parser.ch == 0 {
+	// Read and evaluate each expression in the file
+	for {
+		expr, e := parser.read()
+		if e == io.EOF {
 			break
-		}
-
-		expr := parser.readExpr()
-		if T(expr) == ATOM && equ(expr, atom("ERR")) {
+		} else if e != nil {
+			misread = e
 			return atom("PARSE-ERROR")
 		}
 
-		result = eval(expr, env) // Always use current global env
+		clearFailure()
+		result = run(expr) // Always use current global env
 		if T(result) == ATOM && equ(result, atom("ERR")) {
 			return atom("EVAL-ERROR")
 		}
@@ -373,353 +440,300 @@ func loadFile(filename string, _ L) L {
 // Primitive wrapper for loadFile
 func f_load(t, e L) L {
 	// Get the filename argument
-	args := evlis(t, e)
-	if notv(args) {
+	if notv(t) {
 		return atom("MISSING-FILENAME")
 	}
 
-	// Extract filename string from atom
-	filenameAtom := car(args)
-	if T(filenameAtom) != ATOM {
+	// Extract filename from a string or an atom
+	var filename string
+	switch x := car(t); T(x) {
+	case STRG:
+		filename = text(x)
+	case ATOM:
+		filename = name(x)
+	default:
 		return atom("INVALID-FILENAME")
 	}
 
-	i := ord(filenameAtom)
-	filename := ""
-	for j := i; A[j] != 0; j++ {
-		filename += string(A[j])
-	}
-
 	// Load and evaluate the file using global environment
 	return loadFile(filename, env)
 }
 
-// Primitive table with all primitives
-var prims map[string]func(L, L) L
-
 // Store primitive index mapping
 var primIndex map[string]I
 
-// Corrected parser that handles EOF gracefully and fixes atom string extraction
-type inputParser struct {
-	input string
-	pos   int
-	ch    byte
-}
-
-func newInputParser(input string) *inputParser {
-	p := &inputParser{input: input, pos: 0}
-	p.next()
-	return p
-}
-
-func (p *inputParser) next() {
-	if p.pos < len(p.input) {
-		p.ch = p.input[p.pos]
-		p.pos++
-	} else {
-		p.ch = 0 // EOF
-	}
-}
-
-func (p *inputParser) skipWhitespace() {
-	for p.ch > 0 && p.ch <= ' ' {
-		p.next()
-	}
-}
-
-func (p *inputParser) readAtom() L {
-	start := p.pos - 1 // Start at current character position
-	// Keep reading while we have valid atom characters
-	for p.ch > ' ' && p.ch != '(' && p.ch != ')' && p.ch != '\'' && p.ch != 0 {
-		p.next()
-	}
-	// Extract the atom string - end is where we stopped
-	end := p.pos
-	if p.ch != 0 {
-		end = p.pos - 1 // Back up one if we stopped on a delimiter
-	}
-	s := p.input[start:end]
-
-	// Try to parse as number using strconv
-	if len(s) > 0 {
-		if n, err := strconv.ParseFloat(s, 64); err == nil {
-			return L(n)
-		}
-	}
-
-	// Return as atom
-	return atom(s)
-}
-
-func (p *inputParser) readList() L {
-	p.skipWhitespace()
-	if p.ch == ')' {
-		p.next()
-		return nilv
-	}
-	if p.ch == 0 {
-		return nilv
-	}
-
-	// Handle dot notation
-	if p.ch == '.' {
-		p.next()
-		p.skipWhitespace()
-		result := p.readExpr()
-		p.skipWhitespace()
-		if p.ch == ')' {
-			p.next()
-		}
-		return result
+// prim describes a primitive; special forms receive their arguments unevaluated
+type prim struct {
+	s string
+	f func(L, L) L
+	m bool
+}
+
+// Primitives in ordinal order
+var primTab []prim
+
+// primitives lists the built-in primitives in the order their ordinals are assigned
+func primitives() []prim {
+	return []prim{
+		{"eval", f_eval, false},
+		{"quote", f_quote, true},
+		{"cons", f_cons, false},
+		{"car", f_car, false},
+		{"cdr", f_cdr, false},
+		{"+", f_add, false},
+		{"-", f_sub, false},
+		{"*", f_mul, false},
+		{"/", f_div, false},
+		{"int", f_int, false},
+		{"<", f_lt, false},
+		{"eq?", f_eq, false},
+		{"pair?", f_pair, false},
+		{"or", f_or, true},
+		{"and", f_and, true},
+		{"not", f_not, false},
+		{"cond", f_cond, true},
+		{"if", f_if, true},
+		{"let*", f_leta, true},
+		{"lambda", f_lambda, true},
+		{"define", f_define, true},
+		{"load", f_load, false},
+		{"disassemble", f_disassemble, false},
+		{"environment-bindings", f_bindings, false},
+		{"define-constant", f_define_constant, true},
+		{"optimize", f_optimize, false},
+		{"string?", f_stringp, false},
+		{"string-length", f_string_length, false},
+		{"substring", f_substring, false},
+		{"string-append", f_string_append, false},
+		{"string->symbol", f_string_symbol, false},
+		{"symbol->string", f_symbol_string, false},
+		{"number->string", f_number_string, false},
+		{"string->number", f_string_number, false},
+		{"string-split", f_string_split, false},
+		{"string-join", f_string_join, false},
+		{"string-upcase", f_string_upcase, false},
+		{"string-downcase", f_string_downcase, false},
+		{"string=?", f_string_eq, false},
+		{"string<?", f_string_lt, false},
+		{"string>?", f_string_gt, false},
+		{"string<=?", f_string_le, false},
+		{"string>=?", f_string_ge, false},
+		{"char?", f_charp, false},
+		{"char->integer", f_char_integer, false},
+		{"integer->char", f_integer_char, false},
+		{"char-upcase", f_char_upcase, false},
+		{"char-downcase", f_char_downcase, false},
+		{"char-alphabetic?", f_char_alphabetic, false},
+		{"char-numeric?", f_char_numeric, false},
+		{"char-whitespace?", f_char_whitespace, false},
+		{"char=?", f_char_eq, false},
+		{"char<?", f_char_lt, false},
+		{"string-ref", f_string_ref, false},
+		{"string->list", f_string_list, false},
+		{"list->string", f_list_string, false},
+		{"read-char", f_read_char, false},
+		{"peek-char", f_peek_char, false},
+		{"write-char", f_write_char, false},
+		{"vector?", f_vectorp, false},
+		{"make-vector", f_make_vector, false},
+		{"vector", f_vector, false},
+		{"vector-ref", f_vector_ref, false},
+		{"vector-set!", f_vector_set, false},
+		{"vector-length", f_vector_length, false},
+		{"vector->list", f_vector_list, false},
+		{"list->vector", f_list_vector, false},
+		{"vector-map", f_vector_map, false},
+		{"vector-fill!", f_vector_fill, false},
+		{"equal?", f_equal, false},
+		{"make-hash-table", f_make_hash_table, false},
+		{"hash-table?", f_hash_tablep, false},
+		{"hash-ref", f_hash_ref, false},
+		{"hash-set!", f_hash_set, false},
+		{"hash-remove!", f_hash_remove, false},
+		{"hash-keys", f_hash_keys, false},
+		{"hash-count", f_hash_count, false},
+		{"hash-for-each", f_hash_for_each, false},
+		{"=", f_num_eq, false},
+		{"number?", f_numberp, false},
+		{"integer?", f_integerp, false},
+		{"exact?", f_exactp, false},
+		{"inexact?", f_inexactp, false},
+		{"exact->inexact", f_exact_inexact, false},
+		{"inexact->exact", f_inexact_exact, false},
+		{"logand", f_logand, false},
+		{"logior", f_logior, false},
+		{"logxor", f_logxor, false},
+		{"lognot", f_lognot, false},
+		{"ash", f_ash, false},
+		{"bit-count", f_bit_count, false},
+		{"define-record-type", f_define_record_type, true},
+		{"gensym", f_gensym, false},
+		{"get", f_get, false},
+		{"put", f_put, false},
+		{"symbol-plist", f_symbol_plist, false},
+		{"read", f_read, false},
+		{"trace", f_trace, false},
+		{"pp", f_pp, false},
+		{"print", f_print, false},
+		{"println", f_println, false},
+		{"write", f_write, false},
+		{"display", f_display, false},
+		{"newline", f_newline, false},
+		{"set-macro-character", f_set_macro_character, false},
+		{"set-dispatch-macro-character", f_set_dispatch_macro_character, false},
+		{"read-delimited-list", f_read_delimited_list, false},
+		{"current-output-port", f_current_output_port, false},
+		{"open-output-string", f_open_output_string, false},
+		{"get-output-string", f_get_output_string, false},
+		{"output-port?", f_output_portp, false},
+		{"format", f_format, false},
+		{"set-car!", f_set_car, false},
+		{"set-cdr!", f_set_cdr, false},
+	}
+}
+
+// setup initializes the configuration, the constants, the primitive tables and the global environment
+func setup(opts ...option) {
+	conf = config{}
+	for _, o := range opts {
+		o(&conf)
 	}
-
-	first := p.readExpr()
-	rest := p.readList()
-	return cons(first, rest)
-}
-
-func (p *inputParser) readExpr() L {
-	p.skipWhitespace()
-
-	switch p.ch {
-	case 0:
-		return nilv
-	case '(':
-		p.next()
-		return p.readList()
-	case '\'':
-		p.next()
-		return cons(atom("quote"), cons(p.readExpr(), nilv))
-	default:
-		return p.readAtom()
+	nilv = box(NIL, 0)
+	err = atom("ERR")
+	tru = atom("#t")
+	env = nilv
+	strs, hashes, bigs, floats, rtypes, codes = nil, nil, nil, nil, nil, nil
+	ports = []io.Writer{standard}
+	plists, gensyms = make(map[I]L), 0
+	locs, failure, backtrace, calls, tracing = make(map[I]pos), nilv, nil, nil, false
+	macros, dispatches, macroReader = nil, nil, nil
+	globals, gnames, gconst, gslots = nil, nil, nil, make(map[I]int)
+	define(tru, tru)
+	primIndex = make(map[string]I)
+	primTab = primitives()
+	for i, p := range primTab {
+		primIndex[p.s] = I(i)
+		define(atom(p.s), box(PRIM, I(i)))
 	}
+	keep()
 }
 
 // Error handling for primitives
 func apply(f, t, e L) L {
-	if T(f) == PRIM {
-		// Use the ordinal to look up the primitive directly
-		primOrd := ord(f)
-		for name, fn := range prims {
-			if primIndex[name] == primOrd {
-				return fn(t, e)
-			}
-		}
-		return err
-	} else if T(f) == CLOS {
-		return eval(cdr(car(f)), bind(car(car(f)), evlis(t, e), ifv(cdr(f), env)))
+	if T(f) == PRIM && ord(f) < I(len(primTab)) && primTab[ord(f)].m {
+		return primTab[ord(f)].f(t, e)
+	} else if T(f) == PRIM || T(f) == CLOS {
+		return invoke(f, evlis(t, e))
 	}
 	return err
 }
 
-// Print function with type detection
-func printExpr(x L) {
-	switch T(x) {
-	case NIL:
-		fmt.Print("()")
-	case ATOM:
-		i := ord(x)
-		s := ""
-		for j := i; A[j] != 0; j++ {
-			s += string(A[j])
-		}
-		fmt.Print(s)
-	case PRIM:
-		fmt.Print("<primitive>")
-	case CONS:
-		printlist(x)
-	case CLOS:
-		fmt.Printf("{closure %d}", ord(x))
-	default:
-		fmt.Printf("%.10g", float64(x))
-	}
-}
-
-func printlist(t L) {
-	fmt.Print("(")
-	first := true
-	for {
-		if !first {
-			fmt.Print(" ")
-		}
-		printExpr(car(t))
-		t = cdr(t)
-		if notv(t) {
-			break
+// invoke applies f to a list of evaluated arguments
+func invoke(f, t L) L {
+	if T(f) == PRIM {
+		if ord(f) < I(len(primTab)) {
+			return primTab[ord(f)].f(t, env)
 		}
-		if T(t) != CONS {
-			fmt.Print(" . ")
-			printExpr(t)
-			break
+	} else if T(f) == CLOS {
+		if p := compiled(f); p != nil && p.run != nil {
+			return p.run(p.enter(t, cdr(f)))
+		} else if p != nil {
+			return execute(f, t)
 		}
-		first = false
-	}
-	fmt.Print(")")
-}
-
-func gc() {
-	sp = ord(env)
-}
-
-var (
-	buf      = make([]byte, 40)
-	see byte = ' '
-	rdr      = bufio.NewReader(os.Stdin)
-)
-
-func look() {
-	c, err := rdr.ReadByte()
-	if err != nil {
-		os.Exit(0)
+		return eval(cdr(car(f)), bind(car(car(f)), t, ifv(cdr(f), env)))
 	}
-	see = c
+	return err
 }
 
-func seeing(c byte) bool {
-	if c == ' ' {
-		return see > 0 && see <= c
+// entry boxes the last of the n entries of a table of values with tag t, out of
+// memory if its index is beyond the ordinals a boxed value can hold
+func entry(t I, n int) L {
+	if I(n-1) > maxOrd {
+		panic("out of memory")
 	}
-	return see == c
+	return box(t, I(n-1))
 }
 
-func get() byte {
-	c := see
-	look()
-	return c
+// keep protects the cells and strings allocated so far from gc. Besides define,
+// everything that stores a value into an older pair, vector, record, hash
+// table, property list or readtable calls it through retain, since the value
+// may be newer than what holds it and would otherwise be freed.
+func keep() {
+	top, strtop, hashtop, bigtop, floattop, porttop, codetop = sp, len(strs), len(hashes), len(bigs), len(floats), len(ports), len(codes)
 }
 
-func scan() byte {
-	i := 0
-	for seeing(' ') {
-		look()
-	}
-	if seeing('(') || seeing(')') || seeing('\'') {
-		buf[i] = get()
-		i++
-	} else {
-		for i < 39 && !seeing('(') && !seeing(')') && !seeing(' ') {
-			buf[i] = get()
-			i++
+// retain calls keep if x was allocated after the latest keep; atoms, numbers and
+// older values are never freed by gc, so storing them keeps nothing
+func retain(x L) {
+	var n int // the length of the table of x at the latest keep
+	switch T(x) {
+	case CONS, CLOS, FRAM, VECT, RECD:
+		if ord(x) < top {
+			keep()
 		}
+		return
+	case STRG:
+		n = strtop
+	case HASH:
+		n = hashtop
+	case BIGN:
+		n = bigtop
+	case FLOT:
+		n = floattop
+	case PORT:
+		n = porttop
+	case CODE:
+		n = codetop
+	default:
+		return
 	}
-	buf[i] = 0
-	return buf[0]
-}
-
-func Read() L {
-	scan()
-	return parse()
-}
-
-func list() L {
-	var x L
-	if scan() == ')' {
-		return nilv
-	}
-	if string(buf[:1]) == "." {
-		x = Read()
-		scan()
-		return x
+	if ord(x) >= I(n) {
+		keep()
 	}
-	x = parse()
-	return cons(x, list())
 }
 
-func quoteExpr() L {
-	return cons(atom("quote"), cons(Read(), nilv))
-}
-
-func atomic() L {
-	s := string(buf[:])
-	n, err := strconv.ParseFloat(s, 64)
-	if err == nil {
-		return L(n)
-	}
-	return atom(s)
+func gc() {
+	sp, strs, hashes, bigs, floats, ports, codes = top, strs[:strtop], hashes[:hashtop], bigs[:bigtop], floats[:floattop], ports[:porttop], codes[:codetop]
+	forget()
 }
 
-func parse() L {
-	switch buf[0] {
-	case '(':
-		return list()
-	case '\'':
-		return quoteExpr()
-	default:
-		return atomic()
-	}
-}
+// Buffered standard input, shared by the REPL, read, read-char and peek-char
+var rdr = bufio.NewReader(os.Stdin)
 
 // Example usage
 func main() {
-	prims = map[string]func(L, L) L{
-		"eval":   f_eval,
-		"quote":  f_quote,
-		"cons":   f_cons,
-		"car":    f_car,
-		"cdr":    f_cdr,
-		"+":      f_add,
-		"-":      f_sub,
-		"*":      f_mul,
-		"/":      f_div,
-		"int":    f_int,
-		"<":      f_lt,
-		"eq?":    f_eq,
-		"pair?":  f_pair,
-		"or":     f_or,
-		"and":    f_and,
-		"not":    f_not,
-		"cond":   f_cond,
-		"if":     f_if,
-		"let*":   f_leta,
-		"lambda": f_lambda,
-		"define": f_define,
-		"load":   f_load,
+	vm := flag.Bool("vm", false, "compile expressions to bytecode and run them on the VM, for disassemble; slower than the default")
+	opt := flag.Bool("O", false, "optimize expressions before running them")
+	show := flag.Bool("print-optimized", false, "print expressions as optimized before running them, implies -O")
+	decimal := flag.Int("decimal", 0, "use decimal numbers with this many significant digits")
+	round := flag.String("rounding", "half-even", "rounding of decimal numbers: half-even, half-up, half-down, down, up, floor or ceiling")
+	width := flag.Int("pp", 0, "pretty print results within this line width")
+	shared := flag.Bool("shared", false, "label shared structure in printed expressions, not only cycles")
+	flag.Parse()
+	if *vm {
+		run = execTop
+	}
+	if *opt || *show {
+		run = optimizing(run, *show)
 	}
 	fmt.Println("tinylisp")
-	nilv = box(NIL, 0)
-	err = atom("ERR")
-	tru = atom("#t")
-	env = pair(tru, tru, nilv)
-
-	// Initialize primitive index mapping with deterministic order
-	primIndex = make(map[string]I)
-	primOrd := I(0)
-
-	// Use a slice to ensure deterministic order
-	primNames := []string{
-		"eval", "quote", "cons", "car", "cdr", "+", "-", "*", "/", "int",
-		"<", "eq?", "pair?", "or", "and", "not", "cond", "if", "let*", "lambda", "define", "load",
+	r, ok := roundings[*round]
+	if !ok {
+		fmt.Println("unknown rounding", *round)
+		os.Exit(2)
 	}
-
-	for _, name := range primNames {
-		if _, exists := prims[name]; exists {
-			primIndex[name] = primOrd
-			env = pair(atom(name), box(PRIM, primOrd), env)
-			primOrd++
-		}
+	var opts []option
+	if *decimal > 0 {
+		opts = append(opts, withDecimal(*decimal, r))
 	}
-	// REPL using safer input handling
-	scanner := bufio.NewScanner(os.Stdin)
-	for {
-		fmt.Printf("\n%d> ", int(sp)-int(hp)/8)
-		if !scanner.Scan() {
-			break // EOF or error
-		}
-
-		input := scanner.Text()
-		if input == "" {
-			continue // Skip empty lines
-		}
-
-		// Parse using our corrected parser logic (same as tests)
-		parser := &inputParser{input: input, pos: 0}
-		parser.next()
-		expr := parser.readExpr()
-
-		// Evaluate and print
-		result := eval(expr, env)
-		printExpr(result)
-		gc()
+	if *width > 0 {
+		opts = append(opts, withWidth(*width))
 	}
+	if *shared {
+		opts = append(opts, withShared())
+	}
+	setup(opts...)
+
+	// REPL reading expressions from rdr, which read, read-char and peek-char share
+	repl()
 }
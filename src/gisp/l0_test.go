@@ -12,54 +12,8 @@ func initTinyLisp() {
 	sp = N
 	A = make([]byte, N*8)
 	
-	// Initialize constants
-	nilv = box(NIL, 0)
-	err = atom("ERR")
-	tru = atom("#t")
-	env = pair(tru, tru, nilv)
-	
-	// Initialize primitive table
-	prims = map[string]func(L, L) L{
-		"eval":   f_eval,
-		"quote":  f_quote,
-		"cons":   f_cons,
-		"car":    f_car,
-		"cdr":    f_cdr,
-		"+":      f_add,
-		"-":      f_sub,
-		"*":      f_mul,
-		"/":      f_div,
-		"int":    f_int,
-		"<":      f_lt,
-		"eq?":    f_eq,
-		"pair?":  f_pair,
-		"or":     f_or,
-		"and":    f_and,
-		"not":    f_not,
-		"cond":   f_cond,
-		"if":     f_if,
-		"let*":   f_leta,
-		"lambda": f_lambda,
-		"define": f_define,
-	}
-	
-	// Add primitives to environment with unique ordinals in deterministic order
-	primIndex = make(map[string]I)
-	primOrd := I(0)
-	
-	// Use same deterministic order as main
-	primNames := []string{
-		"eval", "quote", "cons", "car", "cdr", "+", "-", "*", "/", "int", 
-		"<", "eq?", "pair?", "or", "and", "not", "cond", "if", "let*", "lambda", "define",
-	}
-	
-	for _, name := range primNames {
-		if _, exists := prims[name]; exists {
-			primIndex[name] = primOrd
-			env = pair(atom(name), box(PRIM, primOrd), env)
-			primOrd++
-		}
-	}
+	// Initialize constants, primitives and the global environment
+	setup()
 }
 
 func TestNaNBoxing(t *testing.T) {
@@ -99,7 +53,11 @@ func TestNumbers(t *testing.T) {
 		val := L(n)
 		// Numbers should be finite (not NaN or Inf) and preserve their value
 		if !math.IsInf(float64(val), 0) && !math.IsNaN(float64(val)) {
-			if float64(val) != n {
+			want := n
+			if floatBits == 32 {
+				want = float64(float32(n))
+			}
+			if float64(val) != want {
 				t.Errorf("Number boxing failed: got %f, want %f", float64(val), n)
 			}
 		} else {
@@ -510,4 +468,15 @@ func TestEqFunction(t *testing.T) {
 	if equ(n1, n3) {
 		t.Error("Different numbers should not be equal")
 	}
-}
\ No newline at end of file
+}
+
+func TestSetCarCdr(t *testing.T) {
+	initTinyLisp()
+	x := evalAll("(define p (cons 1 2)) (set-car! p 'a) (set-cdr! p '(b)) p")
+	if s := printed(x); s != "(a b)" {
+		t.Errorf("set-car! and set-cdr! made %s, want (a b)", s)
+	}
+	if !equ(evalAll("(set-car! 'x 1)"), err) {
+		t.Error("set-car! of a value that is not a pair should return ERR")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Datum labels: the printer writes a cons, vector, record or hash table that is
+// part of a cycle as #n= before its first occurrence and #n# at the others, so
+// circular structures print finitely. With sharing set up it labels every value
+// reached more than once, so that reading the output back gives the same
+// structure. The reader reads #n= and #n# in conses and vectors, making the
+// references of a label point to the expression it labels.
+
+// Error of a datum label that is malformed or refers to no expression
+var errLabel = errors.New("bad datum label")
+
+// withShared makes the printer label shared structure as well as cycles
+func withShared() option {
+	return func(c *config) {
+		c.shared = true
+	}
+}
+
+// compound reports whether x is a value that holds other values
+func compound(x L) bool {
+	switch T(x) {
+	case CONS, VECT, RECD, HASH:
+		return true
+	}
+	return false
+}
+
+// elements returns the values held by x other than the car and cdr of a cons
+func elements(x L) []L {
+	switch T(x) {
+	case VECT:
+		return cell[ord(x)+1 : ord(x)+1+I(vlen(x))]
+	case RECD:
+		return cell[ord(x)+1 : ord(x)+1+I(len(rtypeOf(x).fields))]
+	case HASH:
+		return append(append([]L(nil), hashOf(x).keys...), hashOf(x).vals...)
+	}
+	return nil
+}
+
+// labelled returns the values of x to label by bit pattern, mapped to -1: those
+// in a cycle, and if shared those reached more than once; nil if there are none
+func labelled(x L, shared bool) map[uint64]int {
+	var labels map[uint64]int
+	path := make(map[uint64]bool) // values seen, true while being scanned
+	var scan func(x L)
+	scan = func(x L) {
+		var spine []uint64
+		for ; compound(x); x = cdr(x) {
+			k := pattern(x)
+			if scanning, ok := path[k]; ok {
+				if scanning || shared {
+					if labels == nil {
+						labels = make(map[uint64]int)
+					}
+					labels[k] = -1
+				}
+				break
+			}
+			path[k] = true
+			spine = append(spine, k)
+			if T(x) != CONS {
+				for _, y := range elements(x) {
+					scan(y)
+				}
+				break
+			}
+			scan(car(x))
+		}
+		for _, k := range spine {
+			path[k] = false
+		}
+	}
+	scan(x)
+	return labels
+}
+
+// label reads a datum label after its #, returning the expression it labels
+// or the one it refers to
+func (p *reader) label() (L, error) {
+	n := 0
+	for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+		n = 10*n + int(p.next()-'0')
+		if n > maxOrd {
+			return err, errLabel
+		}
+	}
+	switch p.next() {
+	case '#':
+		if x, ok := p.labels[n]; ok {
+			return x, nil
+		}
+		return err, fmt.Errorf("%w #%d#", errLabel, n)
+	case '=':
+		if p.labels == nil {
+			p.labels = make(map[int]L)
+		}
+		// References read before the expression is complete point to a
+		// placeholder cons, replaced by the expression afterwards
+		hole := cons(nilv, nilv)
+		p.labels[n] = hole
+		x, e := p.expr()
+		if e != nil {
+			return err, e
+		} else if equ(x, hole) {
+			return err, fmt.Errorf("%w #%d=#%d#", errLabel, n, n)
+		}
+		p.labels[n] = x
+		fill(x, hole, x, make(map[uint64]bool))
+		return x, nil
+	}
+	return err, errLabel
+}
+
+// fill replaces hole by x in the conses and vectors of y
+func fill(y, hole, x L, seen map[uint64]bool) {
+	for ; compound(y) && !seen[pattern(y)]; y = cdr(y) {
+		seen[pattern(y)] = true
+		switch T(y) {
+		case CONS:
+			if equ(car(y), hole) {
+				cell[ord(y)+1] = x
+			} else {
+				fill(car(y), hole, x, seen)
+			}
+			if equ(cdr(y), hole) {
+				cell[ord(y)] = x
+			}
+		case VECT:
+			for i := ord(y) + 1; i <= ord(y)+I(vlen(y)); i++ {
+				if equ(cell[i], hole) {
+					cell[i] = x
+				} else {
+					fill(cell[i], hole, x, seen)
+				}
+			}
+			return
+		default:
+			return
+		}
+	}
+}
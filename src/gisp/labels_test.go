@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Tests for datum labels in the printer and the reader
+
+func TestReadLabels(t *testing.T) {
+	initTinyLisp()
+	x := readOne("#0=(a b . #0#)")
+	if !equ(cdr(cdr(x)), x) {
+		t.Error("#0# after the dot should refer to the list it labels")
+	}
+	x = readOne("(#0=(x) #0#)")
+	if !equ(car(x), car(cdr(x))) {
+		t.Error("#0# should refer to the same list as #0=")
+	}
+	x = readOne("#0=#(1 #0#)")
+	if T(x) != VECT || !equ(cell[ord(x)+2], x) {
+		t.Error("#0# in a vector should refer to the vector it labels")
+	}
+	x = readOne("#0=(#1=(b . #1#) . #0#)")
+	if !equ(cdr(x), x) || !equ(cdr(car(x)), car(x)) {
+		t.Error("nested labels should each refer to their own expression")
+	}
+}
+
+func TestLabelErrors(t *testing.T) {
+	for _, input := range []string{"#0=#0#", "#5#", "(#0=a #1#)", "#0", "#0x"} {
+		initTinyLisp()
+		if _, e := newReader(strings.NewReader(input)).read(); !errors.Is(e, errLabel) {
+			t.Errorf("read(%q) error = %v, want %v", input, e, errLabel)
+		}
+	}
+	initTinyLisp()
+	p := newReader(strings.NewReader("#0=(a) #0#"))
+	p.read()
+	if _, e := p.read(); !errors.Is(e, errLabel) {
+		t.Error("labels should not be kept from one expression to the next")
+	}
+}
+
+func TestPrintCycles(t *testing.T) {
+	for _, input := range []string{
+		"#0=(a b . #0#)",
+		"#0=(x #0# y)",
+		"#0=#(1 #0#)",
+		"(1 #0=(2 . #0#))",
+		"#0=(#1=(b . #1#) . #0#)",
+	} {
+		initTinyLisp()
+		if s := printed(readOne(input)); s != input {
+			t.Errorf("%s printed as %s", input, s)
+		}
+	}
+}
+
+func TestPrintVectorCycle(t *testing.T) {
+	initTinyLisp()
+	if s := printed(evalAll("(define v (vector 1 2)) (vector-set! v 1 v) v")); s != "#0=#(1 #0#)" {
+		t.Errorf("a vector holding itself printed as %s, want #0=#(1 #0#)", s)
+	}
+}
+
+func TestPrintSharing(t *testing.T) {
+	initTinyLisp()
+	x := readOne("(#0=(x) #0# #0#)")
+	if s := printed(x); s != "((x) (x) (x))" {
+		t.Errorf("shared structure without cycles should print without labels by default, got %s", s)
+	}
+	hp = 0
+	sp = N
+	A = make([]byte, N*8)
+	setup(withShared())
+	x = readOne("(#0=(x) #0# (y #0#))")
+	s := printed(x)
+	if s != "(#0=(x) #0# (y #0#))" {
+		t.Errorf("shared structure should be labelled when set up, got %s", s)
+	}
+	if y := readOne(s); !equ(car(y), car(cdr(y))) || printed(y) != s {
+		t.Error("the labelled output should read back as the same structure")
+	}
+}
+
+func TestPrettyPrintCycle(t *testing.T) {
+	initTinyLisp()
+	var b strings.Builder
+	PrettyPrint(&b, readOne("#0=(define f (lambda (x) (g x)) . #0#)"), 10)
+	if b.String() != "#0=(define f (lambda (x) (g x)) . #0#)" {
+		t.Errorf("a cyclic expression should be pretty printed on one line, got:\n%s", b.String())
+	}
+}
@@ -0,0 +1,57 @@
+//go:build !float32
+
+package main
+
+import "math"
+
+// NaN boxing in doubles, like tinylisp.c: the upper 16 bits of a quiet NaN hold
+// the tag and the lower 48 bits the ordinal. Build with -tags float32 to box in
+// single precision floats instead, see nanbox32.go.
+
+// NaN boxing constants
+const (
+	ATOM = 0x7ff8
+	PRIM = 0x7ff9
+	CONS = 0x7ffa
+	CLOS = 0x7ffb
+	NIL  = 0x7ffc
+	CODE = 0x7ffd
+	FRAM = 0x7ffe
+	STRG = 0x7fff
+	CHAR = 0xfff9
+	VECT = 0xfffa
+	HASH = 0xfffb
+	BIGN = 0xfffc
+	RECD = 0xfffd
+	PORT = 0xfffe
+	FLOT = 0xffff
+)
+
+type L float64
+type I uint64
+
+const (
+	cellSize     = 8         // bytes of a cell, the heap of atoms grows toward the stack in these units
+	maxOrd       = 1<<48 - 1 // largest ordinal of a boxed value
+	maxSmall     = 1 << 53   // largest exact integer held by a number
+	numberFormat = "%.10g"   // format of inexact numbers displayed
+	floatBits    = 64        // bits of inexact numbers
+)
+
+// NaN boxing helpers
+func box(t, i I) L {
+	return L(math.Float64frombits(uint64(t)<<48 | uint64(i)))
+}
+
+func T(x L) I {
+	return I(math.Float64bits(float64(x)) >> 48)
+}
+
+func ord(x L) I {
+	return I(math.Float64bits(float64(x)) & 0xFFFFFFFFFFFF)
+}
+
+// pattern returns the bit pattern of x
+func pattern(x L) uint64 {
+	return math.Float64bits(float64(x))
+}
@@ -0,0 +1,62 @@
+//go:build float32
+
+package main
+
+import "math"
+
+// NaN boxing in single precision floats, like tinylisp-float.c, for comparing
+// with the embedded C targets: the upper 13 bits of a quiet NaN hold the tag and
+// the lower 19 bits the ordinal. ATOM, PRIM, CONS, CLOS and NIL have the bit
+// patterns of the 12 bit tags of tinylisp-float.c, for ordinals below 2^19. The
+// tags 0x0ff8 and 0x1ff8 with ordinal 0 are the NaNs produced by arithmetic, so
+// ATOM takes the first to make nan the atom ERR and the second is not used.
+// Numbers are exact integers up to 2^24 and print with 6 significant digits,
+// and characters beyond U+7FFFF cannot be boxed.
+
+// NaN boxing constants
+const (
+	ATOM = 0x0ff8 // 0x7fc of tinylisp-float.c
+	CODE = 0x0ff9
+	PRIM = 0x0ffa // 0x7fd of tinylisp-float.c
+	FRAM = 0x0ffb
+	CONS = 0x0ffc // 0x7fe of tinylisp-float.c
+	STRG = 0x0ffd
+	CLOS = 0x0ffe // 0x7ff of tinylisp-float.c
+	CHAR = 0x0fff
+	VECT = 0x1ff9
+	HASH = 0x1ffa
+	BIGN = 0x1ffb
+	RECD = 0x1ffc
+	PORT = 0x1ffd
+	FLOT = 0x1fff
+	NIL  = 0x1ffe // 0xfff of tinylisp-float.c
+)
+
+type L float32
+type I uint32
+
+const (
+	cellSize     = 4         // bytes of a cell, the heap of atoms grows toward the stack in these units
+	maxOrd       = 1<<19 - 1 // largest ordinal of a boxed value
+	maxSmall     = 1 << 24   // largest exact integer held by a number
+	numberFormat = "%.6g"    // format of inexact numbers displayed, %g of tinylisp-float.c
+	floatBits    = 32        // bits of inexact numbers
+)
+
+// NaN boxing helpers
+func box(t, i I) L {
+	return L(math.Float32frombits(uint32(t)<<19 | uint32(i)))
+}
+
+func T(x L) I {
+	return I(math.Float32bits(float32(x)) >> 19)
+}
+
+func ord(x L) I {
+	return I(math.Float32bits(float32(x)) & 0x7FFFF)
+}
+
+// pattern returns the bit pattern of x
+func pattern(x L) uint64 {
+	return uint64(math.Float32bits(float32(x)))
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Exact numbers: integers of at most maxSmall in magnitude are numbers, which
+// hold them exactly. Larger integers and ratios of integers are big.Rat values boxed
+// with the BIGN tag, indexing the bigs table. Any other double is inexact.
+// Inexact numbers with integral values of at most maxSmall in magnitude, such as
+// 2.0, would be exact as doubles, so they are boxed with the FLOT tag instead,
+// indexing the floats table. Operations on exact numbers are exact, promoting to
+// BIGN when a result does not fit and demoting when it does, and an inexact
+// operand makes the result inexact.
+
+// Exact numbers by index, and the number of exact numbers after the latest define
+var (
+	bigs   []*big.Rat
+	bigtop int
+)
+
+// Inexact numbers with small integral values by index, and their number after the latest define
+var (
+	floats   []float64
+	floattop int
+)
+
+// small reports whether x is an exact integer held by a double
+func small(x L) bool {
+	return number(x) && x == L(math.Trunc(float64(x))) && math.Abs(float64(x)) <= maxSmall
+}
+
+// numeric reports whether x is a number, exact or inexact
+func numeric(x L) bool {
+	return number(x) || T(x) == BIGN || T(x) == FLOT
+}
+
+// flonum returns the inexact number closest to f
+func flonum(f float64) L {
+	if g := float64(L(f)); g == math.Trunc(g) && math.Abs(g) <= maxSmall {
+		floats = append(floats, g)
+		return entry(FLOT, len(floats))
+	}
+	return L(f)
+}
+
+// exact returns the value of x as a big.Rat, false if x is not an exact number
+func exact(x L) (*big.Rat, bool) {
+	if T(x) == BIGN {
+		return bigs[ord(x)], true
+	} else if small(x) {
+		return new(big.Rat).SetFloat64(float64(x)), true
+	}
+	return nil, false
+}
+
+// rational returns the value that number x holds as an exact rational, false if x
+// is infinite or not a number
+func rational(x L) (*big.Rat, bool) {
+	if r, ok := exact(x); ok {
+		return r, true
+	} else if f := inexact(x); numeric(x) && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return new(big.Rat).SetFloat64(f), true
+	}
+	return nil, false
+}
+
+// inexact returns the value of number x as a double
+func inexact(x L) float64 {
+	if T(x) == BIGN {
+		f, _ := bigs[ord(x)].Float64()
+		return f
+	} else if T(x) == FLOT {
+		return floats[ord(x)]
+	}
+	return float64(x)
+}
+
+// rat returns the exact number r, as a double if it is a small integer and
+// rounded to a decimal in decimal mode if it is not an integer
+func rat(r *big.Rat) L {
+	if !r.IsInt() && conf.precision > 0 {
+		r = roundDecimal(r)
+	}
+	if r.IsInt() && r.Num().IsInt64() {
+		if n := r.Num().Int64(); n >= -maxSmall && n <= maxSmall {
+			return L(n)
+		}
+	}
+	bigs = append(bigs, r)
+	return entry(BIGN, len(bigs))
+}
+
+// smallArith applies the arithmetic operator op to the small integers x and y,
+// false if the result is not a small integer or y is a zero divisor
+func smallArith(op byte, x, y L) (L, bool) {
+	var z L
+	switch op {
+	case '+':
+		z = x + y
+	case '-':
+		z = x - y
+	case '*':
+		z = x * y
+	case '/':
+		if y == 0 || math.Mod(float64(x), float64(y)) != 0 {
+			return err, false
+		}
+		z = x / y
+	}
+	return z, math.Abs(float64(z)) < maxSmall
+}
+
+// arith applies the arithmetic operator op to the numbers x and y
+func arith(op byte, x, y L) L {
+	if !numeric(x) || !numeric(y) {
+		return err
+	}
+	if small(x) && small(y) {
+		if z, ok := smallArith(op, x, y); ok {
+			return z
+		}
+	}
+	a, ok := exact(x)
+	b, ok2 := exact(y)
+	if !ok || !ok2 {
+		a, b := inexact(x), inexact(y)
+		switch op {
+		case '+':
+			return flonum(a + b)
+		case '-':
+			return flonum(a - b)
+		case '*':
+			return flonum(a * b)
+		}
+		return flonum(a / b)
+	}
+	z := new(big.Rat)
+	switch op {
+	case '+':
+		z.Add(a, b)
+	case '-':
+		z.Sub(a, b)
+	case '*':
+		z.Mul(a, b)
+	case '/':
+		if b.Sign() == 0 {
+			return err
+		}
+		z.Quo(a, b)
+	}
+	return rat(z)
+}
+
+// compareNumbers returns -1, 0 or 1 as number x is less than, equal to or greater than
+// number y, comparing exactly the values they hold, as doubles compare unless one is
+// a big integer or ratio
+func compareNumbers(x, y L) int {
+	if T(x) == BIGN || T(y) == BIGN {
+		a, ok := rational(x)
+		b, ok2 := rational(y)
+		if ok && ok2 {
+			return a.Cmp(b)
+		}
+	}
+	switch p, q := inexact(x), inexact(y); {
+	case p < q:
+		return -1
+	case p > q:
+		return 1
+	}
+	return 0
+}
+
+// Bases of the #x, #b, #o and #d prefixes of integer literals
+var radixes = map[byte]int{'x': 16, 'b': 2, 'o': 8, 'd': 10}
+
+// parseNumber returns the number written as s, false if s is not a number.
+// Integers and ratios are exact, other numbers are inexact unless in decimal mode. Integers may be
+// written in another base with a #x, #b or #o prefix, or a 0x prefix after the sign.
+func parseNumber(s string) (L, bool) {
+	if len(s) > 2 && s[0] == '#' && radixes[s[1]|0x20] > 0 {
+		if n, ok := new(big.Int).SetString(s[2:], radixes[s[1]|0x20]); ok {
+			return rat(new(big.Rat).SetInt(n)), true
+		}
+		return err, false
+	}
+	if t := strings.TrimLeft(s, "+-"); len(s)-len(t) <= 1 && len(t) > 2 && t[0] == '0' && t[1]|0x20 == 'x' {
+		if n, ok := new(big.Int).SetString(t[2:], 16); ok && t[2] != '+' && t[2] != '-' {
+			if s[0] == '-' {
+				n.Neg(n)
+			}
+			return rat(new(big.Rat).SetInt(n)), true
+		}
+	}
+	if n, ok := new(big.Int).SetString(s, 10); ok {
+		return rat(new(big.Rat).SetInt(n)), true
+	}
+	if i := strings.IndexByte(s, '/'); i > 0 {
+		n, ok := new(big.Int).SetString(s[:i], 10)
+		d, ok2 := new(big.Int).SetString(s[i+1:], 10)
+		if ok && ok2 && d.Sign() != 0 {
+			return rat(new(big.Rat).SetFrac(n, d)), true
+		}
+	}
+	if n, e := strconv.ParseFloat(s, 64); e == nil {
+		if r, ok := new(big.Rat).SetString(s); ok && conf.precision > 0 && !strings.ContainsAny(s, "xX") {
+			return rat(r), true
+		}
+		return flonum(n), true
+	}
+	return err, false
+}
+
+// formatRadix returns number x written in base b, false if x is inexact and b is not 10
+func formatRadix(x L, b int) (string, bool) {
+	r, ok := exact(x)
+	if b == 10 {
+		return formatNumber(x), true
+	} else if !ok {
+		return "", false
+	} else if r.IsInt() {
+		return r.Num().Text(b), true
+	}
+	return r.Num().Text(b) + "/" + r.Denom().Text(b), true
+}
+
+// formatNumber returns number x as printed
+func formatNumber(x L) string {
+	if T(x) == BIGN {
+		if r := bigs[ord(x)]; r.IsInt() {
+			return r.Num().String()
+		} else if conf.precision > 0 {
+			return formatDecimal(r)
+		}
+		return bigs[ord(x)].RatString()
+	} else if small(x) {
+		return strconv.FormatInt(int64(x), 10)
+	}
+	return point(fmt.Sprintf(numberFormat, inexact(x)))
+}
+
+// writeNumber returns number x as written to be read back, with inexact numbers
+// in the shortest form that reads as the same number
+func writeNumber(x L) string {
+	if _, ok := exact(x); ok {
+		return formatNumber(x)
+	}
+	return point(strconv.FormatFloat(inexact(x), 'g', -1, floatBits))
+}
+
+// point returns inexact number s with a decimal point added if it looks like an integer
+func point(s string) string {
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+
+// Return #t if the argument is a number
+func f_numberp(t, e L) L {
+	if numeric(car(t)) {
+		return tru
+	}
+	return nilv
+}
+
+// Return #t if the argument is an exact number
+func f_exactp(t, e L) L {
+	if _, ok := exact(car(t)); ok {
+		return tru
+	}
+	return nilv
+}
+
+// Return #t if the argument is an inexact number
+func f_inexactp(t, e L) L {
+	if _, ok := exact(car(t)); !ok && numeric(car(t)) {
+		return tru
+	}
+	return nilv
+}
+
+// Return #t if the argument is an integer
+func f_integerp(t, e L) L {
+	if r, ok := exact(car(t)); ok && r.IsInt() {
+		return tru
+	} else if f := inexact(car(t)); !ok && numeric(car(t)) && f == math.Trunc(f) && !math.IsInf(f, 0) {
+		return tru
+	}
+	return nilv
+}
+
+// Return #t if the numbers are equal
+func f_num_eq(t, e L) L {
+	for ; T(cdr(t)) == CONS; t = cdr(t) {
+		if !numeric(car(t)) || !numeric(car(cdr(t))) {
+			return err
+		}
+		if compareNumbers(car(t), car(cdr(t))) != 0 {
+			return nilv
+		}
+	}
+	return tru
+}
+
+// Return the inexact number closest to a number
+func f_exact_inexact(t, e L) L {
+	if !numeric(car(t)) {
+		return err
+	}
+	return flonum(inexact(car(t)))
+}
+
+// Return the exact number equal to a number
+func f_inexact_exact(t, e L) L {
+	x := car(t)
+	if _, ok := exact(x); ok {
+		return x
+	} else if !numeric(x) || math.IsInf(inexact(x), 0) {
+		return err
+	}
+	return rat(new(big.Rat).SetFloat64(inexact(x)))
+}
+
+// integer returns the value of x as a big.Int, false if x is not an exact integer
+func integer(x L) (*big.Int, bool) {
+	if r, ok := exact(x); ok && r.IsInt() {
+		return new(big.Int).Set(r.Num()), true
+	}
+	return nil, false
+}
+
+// bitwise returns a primitive combining exact integers with op, starting from unit
+func bitwise(unit int64, op func(z, x, y *big.Int) *big.Int) func(t, e L) L {
+	return func(t, e L) L {
+		z := big.NewInt(unit)
+		for ; T(t) == CONS; t = cdr(t) {
+			n, ok := integer(car(t))
+			if !ok {
+				return err
+			}
+			op(z, z, n)
+		}
+		return rat(new(big.Rat).SetInt(z))
+	}
+}
+
+// Bitwise and, inclusive or and exclusive or of exact integers in two's complement
+var (
+	f_logand = bitwise(-1, (*big.Int).And)
+	f_logior = bitwise(0, (*big.Int).Or)
+	f_logxor = bitwise(0, (*big.Int).Xor)
+)
+
+// Return the bitwise complement of an exact integer
+func f_lognot(t, e L) L {
+	n, ok := integer(car(t))
+	if !ok {
+		return err
+	}
+	return rat(new(big.Rat).SetInt(n.Not(n)))
+}
+
+// Largest shift of ash, keeping results to a sensible size
+const maxShift = 1 << 16
+
+// Shift an exact integer left by a number of bits, or right if the number is negative
+func f_ash(t, e L) L {
+	n, ok := integer(car(t))
+	k := car(cdr(t))
+	if !ok || !small(k) || k > maxShift {
+		return err
+	}
+	if k < 0 {
+		n.Rsh(n, uint(-k))
+	} else {
+		n.Lsh(n, uint(k))
+	}
+	return rat(new(big.Rat).SetInt(n))
+}
+
+// Return the number of one bits of a non-negative exact integer, or of zero bits of a negative one
+func f_bit_count(t, e L) L {
+	n, ok := integer(car(t))
+	if !ok {
+		return err
+	}
+	if n.Sign() < 0 {
+		n.Not(n)
+	}
+	c := 0
+	for _, w := range n.Bits() {
+		c += bits.OnesCount(uint(w))
+	}
+	return L(c)
+}
@@ -0,0 +1,206 @@
+package main
+
+import "testing"
+
+// Tests for the exact numbers in numbers.go
+
+// precision returns s64, the expected result of a test in double precision, or
+// s32 in the float32 build
+func precision(s64, s32 string) string {
+	if floatBits == 32 {
+		return s32
+	}
+	return s64
+}
+
+func TestExactNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9007199254740993", "9007199254740993"},
+		{"(+ 9007199254740992 1)", "9007199254740993"},
+		{"(- (+ 9007199254740992 1) 1)", "9007199254740992"},
+		{"(* 99999999999 99999999999)", "9999999999800000000001"},
+		{"(* 9007199254740993 0)", "0"},
+		{"(/ 1 3)", "1/3"},
+		{"(/ 6 4)", "3/2"},
+		{"(/ 12 3)", "4"},
+		{"(+ (/ 1 3) (/ 2 3))", "1"},
+		{"-4/6", "-2/3"},
+		{"(* (/ 1 3) 0.5)", precision("0.1666666667", "0.166667")},
+		{"(+ 100000000000000000000 0.5)", "1e+20"},
+		{"(exact->inexact (/ 1 4))", "0.25"},
+		{"(inexact->exact 0.25)", "1/4"},
+		{"(int (/ 7 2))", "3"},
+		{"(int (/ -7 2))", "-3"},
+		{"(int 1180591620717411303424.0)", "1180591620717411303424"},
+		{"(number->string (/ 1 3))", `"1/3"`},
+		{"123456789012", "123456789012"},
+		{"1.5", "1.5"},
+		{"2.0", "2.0"},
+		{"(/ 7 2.0)", "3.5"},
+		{"(* 2 1.5)", "3.0"},
+		{"(exact->inexact 2)", "2.0"},
+		{"(int 2.0)", "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			x := evalAll(tt.input)
+			got := formatNumber(x)
+			if T(x) == STRG {
+				got = quote(text(x))
+			}
+			if got != tt.expected {
+				t.Errorf("%s = %s, want %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNumberPredicates(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected L
+	}{
+		{"(< (/ 1 3) (/ 1 2))", tru},
+		{"(< 100000000000000000002 100000000000000000001)", nilv},
+		{"(< 0.3 (/ 1 3))", tru},
+		{"(= 1 (/ 2 2) 1.0)", tru},
+		{"(= (/ 1 3) 0.5)", nilv},
+		{"(exact? (/ 1 3))", tru},
+		{"(exact? 0.5)", nilv},
+		{"(inexact? 0.5)", tru},
+		{"(inexact? 2.0)", tru},
+		{"(exact? 2.0)", nilv},
+		{"(exact? (exact->inexact 2))", nilv},
+		{"(exact? (/ 7 2.0))", nilv},
+		{"(exact? (* 2 1.0))", nilv},
+		{"(exact? (+ 1.5 1.5))", nilv},
+		{"(exact? (string->number \"2.0\"))", nilv},
+		{"(exact? (inexact->exact 2.0))", tru},
+		{"(integer? 2.0)", tru},
+		{"(integer? 2.5)", nilv},
+		{"(= 2 2.0)", tru},
+		{"(integer? (/ 4 2))", tru},
+		{"(integer? (/ 1 2))", nilv},
+		{"(number? 100000000000000000000)", tru},
+		{"(number? 'a)", nilv},
+		{"(equal? (/ 1 2) (/ 2 4))", tru},
+		{"(eq? (/ 1 2) (/ 2 4))", tru},
+		{"(eq? (/ 1 2) 0.5)", tru},
+		{"(eq? (/ 1 2) (/ 1 3))", nilv},
+		{"(eq? 1 'a)", nilv},
+		{"(/ 1 0)", err},
+		{"(+ 1 'a)", err},
+		{"(< 'a 1)", err},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			if result := evalAll(tt.input); !equ(result, tt.expected) {
+				t.Errorf("%s = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExactNumbersGC(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define b 100000000000000000000)")
+	evalAll("(* b b)")
+	gc()
+	if len(bigs) != 1 || formatNumber(evalAll("b")) != "100000000000000000000" {
+		t.Error("gc should free the exact numbers created after the latest define and keep the others")
+	}
+}
+
+func TestInexactNumbersGC(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define f 2.0)")
+	evalAll("(+ f 1.0)")
+	gc()
+	if len(floats) != 1 || formatNumber(evalAll("f")) != "2.0" {
+		t.Error("gc should free the inexact integral numbers created after the latest define and keep the others")
+	}
+}
+
+func TestRadixLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#xff", "255"},
+		{"#XFF", "255"},
+		{"#b1010", "10"},
+		{"#o17", "15"},
+		{"#d19", "19"},
+		{"#x-1f", "-31"},
+		{"0x1F", "31"},
+		{"-0x10", "-16"},
+		{"#xffffffffffffffffff", "4722366482869645213695"},
+		{"(number->string 255 16)", `"ff"`},
+		{"(number->string -5 2)", `"-101"`},
+		{"(number->string (/ 1 3) 2)", `"1/11"`},
+		{"(number->string 42)", `"42"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			x := evalAll(tt.input)
+			got := formatNumber(x)
+			if T(x) == STRG {
+				got = quote(text(x))
+			}
+			if got != tt.expected {
+				t.Errorf("%s = %s, want %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	for _, s := range []string{"0x", "#x", "#xg", "0x-1", "#t"} {
+		if T(readOne(s)) != ATOM {
+			t.Errorf("%s should read as an atom", s)
+		}
+	}
+}
+
+func TestBitwise(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(logand #xff #x0f)", "15"},
+		{"(logand -1 #xf0)", "240"},
+		{"(logior 1 2 4)", "7"},
+		{"(logxor 5 3)", "6"},
+		{"(lognot 0)", "-1"},
+		{"(lognot #xffffffffffffffff)", "-18446744073709551616"},
+		{"(ash 1 64)", "18446744073709551616"},
+		{"(ash -8 -1)", "-4"},
+		{"(ash (ash 1 64) -64)", "1"},
+		{"(bit-count 255)", "8"},
+		{"(bit-count -256)", "8"},
+		{"(bit-count (ash 1 100))", "1"},
+		{"(logand 1.5 1)", "ERR"},
+		{"(number->string 0.5 2)", "ERR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			x := evalAll(tt.input)
+			got := formatNumber(x)
+			if equ(x, err) {
+				got = "ERR"
+			}
+			if got != tt.expected {
+				t.Errorf("%s = %s, want %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
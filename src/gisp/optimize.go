@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Optimizer: a source-to-source pass run before evaluation with -O or through
+// the optimize primitive, and printed before evaluation with -print-optimized. It folds calls of pure primitives on literals, drops
+// if and cond branches whose tests are literals, turns lambdas applied on the
+// spot into let* and substitutes let* variables bound to literals. Calls of
+// small non-recursive globals defined with define-constant are inlined the same
+// way. Forms are recognized as the analyzer does, so local variables shadowing
+// primitives and special forms are respected.
+
+// Primitives without side effects, folded when all their arguments are literals
+var pure = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "int": true, "<": true,
+	"eq?": true, "pair?": true, "not": true, "car": true, "cdr": true,
+}
+
+// Largest body in cells of a global to inline, and the deepest nesting of inlined calls
+const (
+	inlineSize  = 32
+	inlineDepth = 8
+)
+
+// optimize returns an expression equivalent to the top-level expression x
+func optimize(x L) L {
+	return opt(x, nil, 0)
+}
+
+// optimizing returns exec running top-level expressions optimized, printing each
+// optimized expression after a ; first if show
+func optimizing(exec func(L) L, show bool) func(L) L {
+	return func(x L) L {
+		x = optimize(x)
+		if show {
+			fmt.Print("; ")
+			printExpr(x)
+			fmt.Println()
+		}
+		return exec(x)
+	}
+}
+
+// number reports whether x is a number rather than a boxed value
+func number(x L) bool {
+	return !math.IsNaN(float64(x))
+}
+
+// literal returns the value of x if it is known before x runs
+func literal(x L, sc *scope) (L, bool) {
+	switch {
+	case number(x) || T(x) == NIL || T(x) == STRG || T(x) == CHAR || T(x) == VECT || T(x) == BIGN || T(x) == FLOT:
+		return x, true
+	case equ(x, tru):
+		return tru, resolvesTo(tru, tru, sc)
+	case T(x) == CONS && named(x, "quote", sc):
+		return car(cdr(x)), true
+	}
+	return err, false
+}
+
+// quoted returns an expression evaluating to the value x in scope sc
+func quoted(x L, sc *scope) (L, bool) {
+	if _, ok := literal(x, sc); ok && T(x) != CONS {
+		return x, true
+	}
+	q := atom("quote")
+	return cons(q, cons(x, nilv)), resolvesTo(q, primitive("quote"), sc)
+}
+
+// resolvesTo reports whether atom v is not a local variable and is globally bound to x
+func resolvesTo(v, x L, sc *scope) bool {
+	i, ok := gslots[ord(v)]
+	_, _, local := sc.lookup(v)
+	return ok && !local && equ(globals[i], x)
+}
+
+// primitive returns the primitive named s
+func primitive(s string) L {
+	return box(PRIM, primIndex[s])
+}
+
+// opt optimizes x in the scope sc of local variables, depth counts the inlined calls around x
+func opt(x L, sc *scope, depth int) L {
+	switch T(x) {
+	case ATOM:
+		return optVar(x, sc)
+	case CONS:
+		if f := resolve(car(x), sc); T(f) == PRIM {
+			p := &primTab[ord(f)]
+			if p.m {
+				return relocate(optForm(p, x, sc, depth), x)
+			}
+			return relocate(fold(p, optList(x, sc, depth), sc), x)
+		}
+		return relocate(optCall(x, sc, depth), x)
+	}
+	return x
+}
+
+// optList optimizes the elements of list t, leaving an atom after a dot alone
+func optList(t L, sc *scope, depth int) L {
+	if T(t) != CONS {
+		return t
+	}
+	x := opt(car(t), sc, depth)
+	return cons(x, optList(cdr(t), sc, depth))
+}
+
+// optVar replaces a variable bound to a literal by the literal
+func optVar(v L, sc *scope) L {
+	if d, i, ok := sc.lookup(v); ok {
+		s := sc
+		for ; d > 0; d-- {
+			s = s.up
+		}
+		if i < len(s.vals) {
+			if _, ok := literal(s.vals[i], sc); ok {
+				return s.vals[i]
+			}
+		}
+		return v
+	}
+	if i, ok := gslots[ord(v)]; ok && gconst[i] && (number(globals[i]) || notv(globals[i])) {
+		return globals[i]
+	}
+	return v
+}
+
+// fold applies the pure primitive p of call x to literal arguments
+func fold(p *prim, x L, sc *scope) L {
+	if !pure[p.s] {
+		return x
+	}
+	var vals []L
+	t := cdr(x)
+	for ; T(t) == CONS; t = cdr(t) {
+		v, ok := literal(car(t), sc)
+		if !ok {
+			return x
+		}
+		vals = append(vals, v)
+	}
+	if !notv(t) {
+		return x
+	}
+	if y := p.f(listOf(vals), env); !equ(y, err) {
+		if q, ok := quoted(y, sc); ok {
+			return q
+		}
+	}
+	return x
+}
+
+// optForm optimizes special form p applied in x
+func optForm(p *prim, x L, sc *scope, depth int) L {
+	t := cdr(x)
+	switch p.s {
+	case "if":
+		c := opt(car(t), sc, depth)
+		if v, ok := literal(c, sc); ok {
+			if notv(v) {
+				return opt(car(cdr(cdr(t))), sc, depth)
+			}
+			return opt(car(cdr(t)), sc, depth)
+		}
+		return cons(car(x), cons(c, optList(cdr(t), sc, depth)))
+	case "cond":
+		var kept []L
+		for ; T(t) == CONS; t = cdr(t) {
+			c := opt(car(car(t)), sc, depth)
+			b := optList(cdr(car(t)), sc, depth)
+			v, ok := literal(c, sc)
+			if ok && notv(v) {
+				continue
+			} else if ok && len(kept) == 0 {
+				return car(b)
+			}
+			kept = append(kept, cons(c, b))
+			if ok {
+				break
+			}
+		}
+		return cons(car(x), listOf(kept))
+	case "and", "or":
+		return cons(car(x), optList(t, sc, depth))
+	case "define", "define-constant":
+		return cons(car(x), cons(car(t), optList(cdr(t), sc, depth)))
+	case "let*":
+		return optLet(x, sc, depth)
+	case "lambda":
+		s := &scope{up: sc}
+		v := car(t)
+		for ; T(v) == CONS; v = cdr(v) {
+			s.names = append(s.names, car(v))
+		}
+		if T(v) == ATOM {
+			s.names = append(s.names, v)
+		}
+		return cons(car(x), cons(car(t), optList(cdr(t), s, depth)))
+	}
+	return x
+}
+
+// optLet optimizes a let*, dropping the variables bound to literals that are substituted everywhere
+func optLet(x L, sc *scope, depth int) L {
+	t := cdr(x)
+	if !letv(t) {
+		return opt(car(t), sc, depth)
+	}
+	s := &scope{up: sc}
+	var vals []L
+	for ; letv(t); t = cdr(t) {
+		y := opt(car(cdr(car(t))), s, depth)
+		vals = append(vals, y)
+		s.names = append(s.names, car(car(t)))
+		if _, ok := literal(y, s); ok {
+			s.vals = append(s.vals, y)
+		} else {
+			s.vals = append(s.vals, err)
+		}
+	}
+	body := opt(car(t), s, depth)
+	rest := cons(body, nilv)
+	for i := len(vals) - 1; i >= 0; i-- {
+		if v := s.names[i]; equ(s.vals[i], err) || occurs(v, rest) {
+			rest = cons(cons(v, cons(vals[i], nilv)), rest)
+		}
+	}
+	if notv(cdr(rest)) {
+		return body
+	}
+	return cons(car(x), rest)
+}
+
+// optCall optimizes a call, reducing it to a let* when the function is a lambda
+// expression or a global that can be inlined
+func optCall(x L, sc *scope, depth int) L {
+	y := optList(x, sc, depth)
+	if f := car(y); T(f) == CONS && named(f, "lambda", sc) {
+		return beta(f, cdr(y), y, sc, depth)
+	}
+	if f := inlinable(car(x), sc); depth < inlineDepth && T(f) == CONS {
+		return beta(f, cdr(y), y, sc, depth+1)
+	}
+	return y
+}
+
+// beta reduces the application x of lambda expression f to the arguments t,
+// binding the parameters with a let* in the order the arguments are evaluated
+func beta(f, t, x L, sc *scope, depth int) L {
+	var bs []L
+	v := car(cdr(f))
+	for ; T(v) == CONS && T(t) == CONS; v, t = cdr(v), cdr(t) {
+		bs = append(bs, cons(car(v), cons(car(t), nilv)))
+	}
+	if !notv(v) || !notv(t) {
+		return x
+	}
+	// Every let* binding sees the earlier ones, so no argument may mention an earlier parameter
+	for i, b := range bs {
+		for _, c := range bs[i+1:] {
+			if occurs(car(b), car(cdr(c))) {
+				return x
+			}
+		}
+	}
+	body := car(cdr(cdr(f)))
+	if len(bs) == 0 {
+		return opt(body, sc, depth)
+	}
+	let := atom("let*")
+	if !resolvesTo(let, primitive("let*"), sc) {
+		return x
+	}
+	return opt(cons(let, listOf(append(bs, body))), sc, depth)
+}
+
+// inlinable returns a lambda expression for global f if it is a small non-recursive
+// constant closure whose body means the same in scope sc
+func inlinable(f L, sc *scope) L {
+	if T(f) != ATOM {
+		return nilv
+	}
+	i, ok := gslots[ord(f)]
+	if _, _, local := sc.lookup(f); !ok || local || !gconst[i] {
+		return nilv
+	}
+	g := globals[i]
+	var v, body L
+	if p := compiled(g); p != nil {
+		v, body = p.params, p.body
+	} else if T(g) == CLOS {
+		v, body = car(car(g)), cdr(car(g))
+	} else {
+		return nilv
+	}
+	if !notv(cdr(g)) || size(body) > inlineSize || occurs(f, body) || captured(body, v, sc) {
+		return nilv
+	}
+	lambda := atom("lambda")
+	if !resolvesTo(lambda, primitive("lambda"), sc) {
+		return nilv
+	}
+	return cons(lambda, cons(v, cons(body, nilv)))
+}
+
+// captured reports whether an atom in x other than the parameters v is a local variable of sc
+func captured(x, v L, sc *scope) bool {
+	switch T(x) {
+	case ATOM:
+		_, _, local := sc.lookup(x)
+		return local && !occurs(x, v)
+	case CONS:
+		return captured(car(x), v, sc) || captured(cdr(x), v, sc)
+	}
+	return false
+}
+
+// occurs reports whether atom v occurs anywhere in x, quoted or not
+func occurs(v, x L) bool {
+	if T(x) == CONS {
+		return occurs(v, car(x)) || occurs(v, cdr(x))
+	}
+	return equ(v, x)
+}
+
+// size returns the number of cells of x
+func size(x L) int {
+	if T(x) == CONS {
+		return 1 + size(car(x)) + size(cdr(x))
+	}
+	return 0
+}
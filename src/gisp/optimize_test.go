@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests for the optimizer in optimize.go
+
+// readOne reads a single expression
+func readOne(input string) L {
+	x, _ := newReader(strings.NewReader(input)).read()
+	return x
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"fold arithmetic", "(+ 1 (* 2 3))", "7"},
+		{"fold comparison", "(if (< 1 2) a b)", "a"},
+		{"fold quoted", "(car '(a b))", "'a"},
+		{"keep variables", "(+ x 1)", "(+ x 1)"},
+		{"dead else branch", "(if () a b)", "b"},
+		{"dead cond clauses", "(cond ((eq? 1 2) x) ((pair? '(1)) y) (z w))", "y"},
+		{"keep cond clauses", "(cond (z w) (() x) (#t y) (v u))", "(cond (z w) (#t y))"},
+		{"beta reduction", "((lambda (x y) (+ x y)) 5 z)", "(let* (y z) (+ 5 y))"},
+		{"beta reduction without parameters", "((lambda () (* 2 3)))", "6"},
+		{"substitute let*", "(let* (x 1) (y (+ x 1)) (f y x))", "(f 2 1)"},
+		{"keep evaluated let*", "(let* (x 1) (eval 'x))", "(let* (x 1) (eval 'x))"},
+		{"argument count mismatch", "((lambda (x y) x) 1)", "((lambda (x y) x) 1)"},
+		{"argument mentions earlier parameter", "((lambda (x y) y) 1 x)", "((lambda (x y) y) 1 x)"},
+		{"local shadows primitive", "((lambda (+) (+ 1 2)) -)", "(let* (+ -) (+ 1 2))"},
+		{"local shadows special form", "((lambda (if) (if 1 2 3)) list)", "(let* (if list) (if 1 2 3))"},
+		{"inline constant", "(sq (+ k 1))", "121"},
+		{"inline with variable argument", "(sq z)", "(let* (x z) (* x x))"},
+		{"no inlining under shadowed free variable", "((lambda (*) (sq 3)) -)", "(let* (* -) (sq 3))"},
+		{"no inlining of recursive globals", "(fact 5)", "(fact 5)"},
+		{"no inlining of variables", "(dbl 5)", "(dbl 5)"},
+		{"keep defined name", "(define k (+ k 1))", "(define k 11)"},
+		{"keep constant name", "(define-constant k 7)", "(define-constant k 7)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTinyLisp()
+			evalAll(`
+				(define-constant sq (lambda (x) (* x x)))
+				(define-constant k 10)
+				(define-constant fact (lambda (n) (if (< n 2) 1 (* n (fact (- n 1))))))
+				(define dbl (lambda (x) (+ x x)))`)
+			if got, want := optimize(readOne(tt.input)), readOne(tt.expected); !equal(got, want) {
+				t.Errorf("optimize %s did not return %s", tt.input, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOptimizeRedefinition(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define-constant k 10) (define k 20)")
+	if x := optimize(readOne("k")); !equ(x, atom("k")) {
+		t.Error("redefining a constant with define should stop it being substituted")
+	}
+	initTinyLisp()
+	evalAll("(define-constant k 10)")
+	if x := eval(optimize(readOne("(define k 20)")), env); !equ(x, atom("k")) || !equ(evalAll("k"), L(20)) {
+		t.Error("an optimized define should redefine the constant it names")
+	}
+}
+
+func TestOptimizePrimitive(t *testing.T) {
+	initTinyLisp()
+	if result := evalAll("(optimize '(- 10 (* 2 3)))"); !equ(result, L(4)) {
+		t.Errorf("(optimize '(- 10 (* 2 3))) = %f, want 4", float64(result))
+	}
+}
+
+func TestOptimizedDotCall(t *testing.T) {
+	initTinyLisp()
+	content, e := os.ReadFile("../../tests/dotcall.lisp")
+	if e != nil {
+		t.Skip("tests/dotcall.lisp not found")
+	}
+	p := newReader(bytes.NewReader(content))
+	for x, e := p.read(); e == nil; x, e = p.read() {
+		x = eval(optimize(x), env)
+		if T(x) == CONS && !equ(car(x), atom("passed")) {
+			t.Errorf("dotcall test failed: %v", cdr(x))
+		}
+	}
+}
+
+func TestPrintOptimized(t *testing.T) {
+	saved := run
+	defer func() { run = saved }()
+	run = optimizing(run, true)
+	out := session("(define xs '(1 2))\n(if #t (car xs) (* 2 3))\n")
+	if !strings.Contains(out, "; (car xs)\n1") {
+		t.Errorf("the optimized expression should be printed before its result, got %q", out)
+	}
+	if !strings.Contains(out, "; (define xs (quote (1 2)))\n") {
+		t.Errorf("an expression the optimizer keeps should be printed as read, got %q", out)
+	}
+}
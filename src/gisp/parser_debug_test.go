@@ -8,8 +8,7 @@ func TestParserAtomDebug(t *testing.T) {
 	initTinyLisp()
 	
 	// Test parsing just "x"
-	parser := newTestParser("x")
-	result := parser.readExpr()
+	result := readOne("x")
 	
 	t.Logf("Parsed 'x': tag=%x ord=%d", T(result), ord(result))
 	
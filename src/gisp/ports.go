@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Output ports: boxed with the PORT tag, indexing the ports table. Port 0 is
+// the standard output, the others are string ports collecting what is written
+// to them until get-output-string. write, display, newline, write-char and
+// format write to a port given as their last argument, or to the standard
+// output. Like strings, ports are freed by gc when they were created after the
+// latest define.
+
+// Output ports by index, and the number of ports after the latest define
+var (
+	ports    []io.Writer
+	porttop  int
+	standard = standardOutput{}
+)
+
+// standardOutput writes to the standard output of the time of writing
+type standardOutput struct{}
+
+func (standardOutput) Write(b []byte) (int, error) {
+	return os.Stdout.Write(b)
+}
+
+// port returns a new output port writing to w
+func port(w io.Writer) L {
+	ports = append(ports, w)
+	return entry(PORT, len(ports))
+}
+
+// portOf returns the writer of output port x
+func portOf(x L) io.Writer {
+	return ports[ord(x)]
+}
+
+// outputPort returns the writer of the optional port of argument list t,
+// the standard output if t is (), false if t is not a port
+func outputPort(t L) (io.Writer, bool) {
+	if notv(t) {
+		return standard, true
+	} else if T(car(t)) != PORT || !notv(cdr(t)) {
+		return nil, false
+	}
+	return portOf(car(t)), true
+}
+
+// Return the port of the standard output
+func f_current_output_port(t, e L) L {
+	return box(PORT, 0)
+}
+
+// Return a new port collecting the output written to it in a string
+func f_open_output_string(t, e L) L {
+	return port(new(strings.Builder))
+}
+
+// Return the output written to a string port so far
+func f_get_output_string(t, e L) L {
+	if T(car(t)) == PORT {
+		if b, ok := portOf(car(t)).(*strings.Builder); ok {
+			return str(b.String())
+		}
+	}
+	return err
+}
+
+// Return #t if the argument is an output port
+func f_output_portp(t, e L) L {
+	if T(car(t)) == PORT {
+		return tru
+	}
+	return nilv
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+// Tests for output ports
+
+func TestStringPorts(t *testing.T) {
+	initTinyLisp()
+	x := evalAll(`(define p (open-output-string))
+(write "a" p) (display " b" p) (newline p) (write-char #\c p)
+(get-output-string p)`)
+	if T(x) != STRG || text(x) != "\"a\" b\nc" {
+		t.Errorf("a string port collected %s", printed(x))
+	}
+	if s := printed(evalAll("(cons (output-port? p) (output-port? \"p\"))")); s != "(#t)" {
+		t.Errorf("output-port? = %s, want (#t)", s)
+	}
+	if x := evalAll("(get-output-string (current-output-port))"); !equ(x, err) {
+		t.Error("the standard output has no string to get")
+	}
+	if x := evalAll("(write 1 'p)"); !equ(x, err) {
+		t.Error("writing to a value that is not a port should make ERR")
+	}
+}
+
+func TestCurrentOutputPort(t *testing.T) {
+	initTinyLisp()
+	if out := stdout(func() { evalAll(`(write "x" (current-output-port)) (newline (current-output-port))`) }); out != "\"x\"\n" {
+		t.Errorf("the current output port wrote %q", out)
+	}
+}
+
+func TestPortsAfterGC(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define p (open-output-string))")
+	evalAll("(open-output-string)")
+	gc()
+	if n := len(ports); n != 2 {
+		t.Errorf("gc kept %d ports, want 2", n)
+	}
+	if x := evalAll(`(display "kept" p) (get-output-string p)`); T(x) != STRG || text(x) != "kept" {
+		t.Errorf("a defined port should survive gc, got %s", printed(x))
+	}
+}
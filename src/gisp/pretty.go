@@ -0,0 +1,197 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Pretty printer: writes an expression as printExpr does when it fits in the
+// line width, breaking the lists that do not fit across lines. A list of atoms
+// is filled line by line under its first argument. The elements of other lists go under the first
+// argument, or under the head if it is not an atom, except that lambda and
+// define keep their first argument on the line of the head and indent the rest
+// by two, if by four, cond by six, and let* aligns its bindings and indents its
+// body by two. Expressions that need datum labels are written on one line. The
+// REPL pretty prints its results when a width is set up.
+
+// Line width of pp when none is given and none is set up
+const defaultWidth = 79
+
+// withWidth makes the REPL pretty print its results within width columns
+func withWidth(width int) option {
+	return func(c *config) {
+		c.width = width
+	}
+}
+
+// pretty holds the state of a pretty printer writing to w
+type pretty struct {
+	w     io.Writer
+	width int
+	col   int // column of the next character written
+}
+
+// PrettyPrint writes x to w, breaking lists across lines to fit within width
+// columns unless x needs datum labels
+func PrettyPrint(w io.Writer, x L, width int) {
+	p := &pretty{w: w, width: width}
+	if compound(x) && labelled(x, conf.shared) != nil {
+		p.print(flat(x))
+		return
+	}
+	p.expr(x)
+}
+
+// flat returns x as printExpr prints it
+func flat(x L) string {
+	var b strings.Builder
+	fprintExpr(&b, x)
+	return b.String()
+}
+
+// print writes s, which holds no newline
+func (p *pretty) print(s string) {
+	io.WriteString(p.w, s)
+	p.col += utf8.RuneCountInString(s)
+}
+
+// newline starts a line indented to column n
+func (p *pretty) newline(n int) {
+	io.WriteString(p.w, "\n"+strings.Repeat(" ", n))
+	p.col = n
+}
+
+// expr writes x at the current column
+func (p *pretty) expr(x L) {
+	s := flat(x)
+	if T(x) != CONS || p.col+utf8.RuneCountInString(s) <= p.width {
+		p.print(s)
+	} else if leaves(x) {
+		p.fill(x)
+	} else {
+		p.list(x)
+	}
+}
+
+// leaves reports whether list t holds no lists
+func leaves(t L) bool {
+	for ; T(t) == CONS; t = cdr(t) {
+		if T(car(t)) == CONS {
+			return false
+		}
+	}
+	return true
+}
+
+// fill writes the list of atoms t, starting a line under its first argument when
+// the next element does not fit but would fit there, or under its head if some
+// element would not fit under the first argument
+func (p *pretty) fill(t L) {
+	start := p.col
+	p.print("(")
+	p.print(flat(car(t)))
+	indent := p.col + 1
+	if indent+widest(cdr(t)) > p.width {
+		indent = start + 1
+	}
+	for t = cdr(t); T(t) == CONS; t = cdr(t) {
+		s := flat(car(t))
+		n := utf8.RuneCountInString(s)
+		if T(cdr(t)) != CONS {
+			n++ // the closing parenthesis
+		}
+		if p.col+1+n > p.width && indent+n <= p.width {
+			p.newline(indent)
+		} else {
+			p.print(" ")
+		}
+		p.print(s)
+	}
+	p.tail(t, indent)
+}
+
+// widest returns the width of the widest element of the list of atoms t on a line
+// of its own, with the closing parenthesis after the last and a dot before an
+// atom after a dot
+func widest(t L) int {
+	n := 0
+	for ; T(t) == CONS; t = cdr(t) {
+		m := utf8.RuneCountInString(flat(car(t)))
+		if T(cdr(t)) == NIL {
+			m++
+		}
+		n = max(n, m)
+	}
+	if T(t) != NIL {
+		n = max(n, utf8.RuneCountInString(flat(t))+3)
+	}
+	return n
+}
+
+// list writes list t, which does not fit on the line, one element per line after
+// the ones kept on the line of the head
+func (p *pretty) list(t L) {
+	start := p.col
+	p.print("(")
+	head := car(t)
+	p.expr(head)
+	t = cdr(t)
+	kept, indent, body := 0, start+1, -1
+	if T(head) == ATOM {
+		kept, indent = 1, p.col+1
+		switch name(head) {
+		case "lambda", "define":
+			indent = start + 2
+		case "if":
+			indent = start + 4
+		case "cond":
+			indent = start + 6
+		case "let*":
+			indent, body = start+6, start+2
+		}
+	}
+	for ; T(t) == CONS; t = cdr(t) {
+		if kept > 0 {
+			p.print(" ")
+			kept--
+		} else if body >= 0 && T(cdr(t)) != CONS {
+			p.newline(body)
+		} else {
+			p.newline(indent)
+		}
+		p.expr(car(t))
+	}
+	p.tail(t, indent)
+}
+
+// tail writes the end of a list after its elements, with t after a dot unless it is ()
+func (p *pretty) tail(t L, indent int) {
+	if T(t) != NIL {
+		if s := flat(t); p.col+4+utf8.RuneCountInString(s) > p.width {
+			p.newline(indent)
+			p.print(". ")
+		} else {
+			p.print(" . ")
+		}
+		p.expr(t)
+	}
+	p.print(")")
+}
+
+// Pretty print an expression within an optional line width, returning ()
+func f_pp(t, e L) L {
+	width := conf.width
+	if w := car(cdr(t)); T(cdr(t)) == CONS && small(w) && w > 0 {
+		width = int(w)
+	} else if T(cdr(t)) == CONS {
+		return err
+	}
+	if width <= 0 {
+		width = defaultWidth
+	}
+	PrettyPrint(os.Stdout, car(t), width)
+	io.WriteString(os.Stdout, "\n")
+	return nilv
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// Tests for the pretty printer
+
+// prettied returns the expression read from input pretty printed within width
+func prettied(input string, width int) string {
+	var b strings.Builder
+	PrettyPrint(&b, readOne(input), width)
+	return b.String()
+}
+
+func TestPrettyPrintFits(t *testing.T) {
+	initTinyLisp()
+	for _, input := range []string{"(a (b c) . d)", `(f "x y" 1.5 #\a)`, "()", "atom"} {
+		if s := prettied(input, 40); s != printed(readOne(input)) {
+			t.Errorf("%s fits in 40 columns and should print on one line, got:\n%s", input, s)
+		}
+	}
+}
+
+func TestPrettyPrintForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		width    int
+		expected string
+	}{
+		{"(define sq (lambda (x) (* x x)))", 20,
+			"(define sq\n  (lambda (x)\n    (* x x)))"},
+		{"(if (< n 2) n (+ (fib (- n 1)) (fib (- n 2))))", 30,
+			"(if (< n 2)\n    n\n    (+ (fib (- n 1))\n       (fib (- n 2))))"},
+		{"(cond ((< x 0) (quote negative)) ((= x 0) (quote zero)))", 34,
+			"(cond ((< x 0) (quote negative))\n      ((= x 0) (quote zero)))"},
+		{"(let* (a (f 1)) (b (g a)) (list a b c d))", 20,
+			"(let* (a (f 1))\n      (b (g a))\n  (list a b c d))"},
+		{"(foo alpha beta gamma (delta epsilon))", 20,
+			"(foo alpha\n     beta\n     gamma\n     (delta epsilon))"},
+		{"((a . 1) (b . 2) (c . 3))", 12,
+			"((a . 1)\n (b . 2)\n (c . 3))"},
+		{"(1 2 3 4 5 6 7 8 9 10 11 12)", 12,
+			"(1 2 3 4 5 6\n   7 8 9 10\n   11 12)"},
+		{"(foo alpha beta gamma delta)", 20,
+			"(foo alpha beta\n     gamma delta)"},
+		{"(foo alpha beta gamma-delta-eps)", 20,
+			"(foo alpha beta\n gamma-delta-eps)"},
+		{"(aaa bbb ccc . ddd)", 10,
+			"(aaa bbb\n ccc\n . ddd)"},
+	}
+	for _, tt := range tests {
+		initTinyLisp()
+		if s := prettied(tt.input, tt.width); s != tt.expected {
+			t.Errorf("%s in %d columns:\n%s\nwant:\n%s", tt.input, tt.width, s, tt.expected)
+		}
+	}
+}
+
+func TestPrettyPrintPastMargin(t *testing.T) {
+	initTinyLisp()
+	s := prettied("(aaaaaaaa (bbbbbbbb (cccccccc (f x y))))", 20)
+	if !strings.Contains(s, "(f x y)") {
+		t.Errorf("a list of atoms that cannot fit anyway should not be broken:\n%s", s)
+	}
+}
+
+func TestPPPrimitive(t *testing.T) {
+	initTinyLisp()
+	out := stdout(func() { evalAll("(pp '(define f (lambda (x) x)) 16)") })
+	if out != "(define f\n  (lambda (x) x))\n" {
+		t.Errorf("pp should pretty print within the width given:\n%s", out)
+	}
+	if out := stdout(func() { evalAll("(pp '(a b))") }); out != "(a b)\n" {
+		t.Errorf("pp without a width should use the default width:\n%s", out)
+	}
+	if x := evalAll("(pp 'a 'wide)"); !equ(x, err) {
+		t.Error("pp should reject a width that is not a positive integer")
+	}
+}
+
+func TestREPLPrettyPrint(t *testing.T) {
+	hp = 0
+	sp = N
+	A = make([]byte, N*8)
+	setup(withWidth(16))
+	saved := rdr
+	defer func() { rdr = saved }()
+	rdr = bufio.NewReader(strings.NewReader("'(define f (lambda (x) x))\n"))
+	if out := stdout(repl); !strings.Contains(out, "(define f\n  (lambda (x) x))") {
+		t.Errorf("the REPL should pretty print results when a width is set up:\n%s", out)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// The printer writes expressions to any io.Writer in one of two modes. Write
+// mode writes them to be read back: strings quoted and escaped, characters in
+// #\ syntax and inexact numbers in the shortest form that reads as the same
+// number. Display mode writes them for people: strings and characters as their
+// text and inexact numbers to ten significant digits. The REPL prints results
+// in write mode. Both modes write datum labels, see labels.go. Records and hash
+// tables, which cannot be read back, are written in #<...> form, which the reader
+// rejects.
+
+// Print function with type detection
+func printExpr(x L) {
+	fprintExpr(os.Stdout, x)
+}
+
+// fprintExpr writes x to w in write mode, with datum labels for cycles and, if
+// set up, for shared structure
+func fprintExpr(w io.Writer, x L) {
+	output(w, x, false)
+}
+
+// fdisplayExpr writes x to w in display mode
+func fdisplayExpr(w io.Writer, x L) {
+	output(w, x, true)
+}
+
+// output writes x to w, in display mode if display
+func output(w io.Writer, x L, display bool) {
+	var labels map[uint64]int
+	if compound(x) {
+		labels = labelled(x, conf.shared)
+	}
+	p := &printer{w, display, labels, 0}
+	p.expr(x)
+}
+
+// printer writes expressions to w
+type printer struct {
+	w       io.Writer
+	display bool
+	labels  map[uint64]int // numbers of the values to label by bit pattern, -1 until written
+	next    int            // number of the next label
+}
+
+// label writes the label of x if it has one, reporting whether x was written before
+func (p *printer) label(x L) bool {
+	n, ok := p.labels[pattern(x)]
+	if !ok {
+		return false
+	} else if n >= 0 {
+		fmt.Fprintf(p.w, "#%d#", n)
+		return true
+	}
+	p.labels[pattern(x)] = p.next
+	fmt.Fprintf(p.w, "#%d=", p.next)
+	p.next++
+	return false
+}
+
+// expr writes x
+func (p *printer) expr(x L) {
+	if p.label(x) {
+		return
+	}
+	w := p.w
+	switch T(x) {
+	case NIL:
+		fmt.Fprint(w, "()")
+	case ATOM:
+		fmt.Fprint(w, name(x))
+	case PRIM:
+		fmt.Fprint(w, "<primitive>")
+	case CONS:
+		p.list(x)
+	case CLOS:
+		fmt.Fprintf(w, "{closure %d}", ord(x))
+	case CODE:
+		fmt.Fprintf(w, "{code %d}", ord(x))
+	case FRAM:
+		fmt.Fprintf(w, "{frame %d}", ord(x))
+	case STRG:
+		if p.display {
+			fmt.Fprint(w, text(x))
+		} else {
+			fmt.Fprint(w, quote(text(x)))
+		}
+	case CHAR:
+		if p.display {
+			fmt.Fprint(w, string(rune(ord(x))))
+		} else {
+			fmt.Fprint(w, charName(rune(ord(x))))
+		}
+	case VECT:
+		fmt.Fprint(w, "#(")
+		for i := 1; i <= vlen(x); i++ {
+			if i > 1 {
+				fmt.Fprint(w, " ")
+			}
+			p.expr(cell[ord(x)+I(i)])
+		}
+		fmt.Fprint(w, ")")
+	case HASH:
+		h := hashOf(x)
+		fmt.Fprint(w, "#<hash-table")
+		if h.equal {
+			fmt.Fprint(w, " equal")
+		}
+		for i, k := range h.keys {
+			fmt.Fprint(w, " (")
+			p.expr(k)
+			fmt.Fprint(w, " . ")
+			p.expr(h.vals[i])
+			fmt.Fprint(w, ")")
+		}
+		fmt.Fprint(w, ">")
+	case PORT:
+		fmt.Fprintf(w, "{port %d}", ord(x))
+	case RECD:
+		rt := rtypeOf(x)
+		fmt.Fprint(w, "#<", rt.name)
+		for i, f := range rt.fields {
+			fmt.Fprint(w, " ", name(f), ": ")
+			p.expr(cell[ord(x)+1+I(i)])
+		}
+		fmt.Fprint(w, ">")
+	default:
+		if p.display {
+			fmt.Fprint(w, formatNumber(x))
+		} else {
+			fmt.Fprint(w, writeNumber(x))
+		}
+	}
+}
+
+// list writes list t, writing a labelled cdr after a dot
+func (p *printer) list(t L) {
+	w := p.w
+	fmt.Fprint(w, "(")
+	first := true
+	for {
+		if !first {
+			fmt.Fprint(w, " ")
+		}
+		p.expr(car(t))
+		t = cdr(t)
+		if notv(t) {
+			break
+		}
+		if _, ok := p.labels[pattern(t)]; T(t) != CONS || ok {
+			fmt.Fprint(w, " . ")
+			p.expr(t)
+			break
+		}
+		first = false
+	}
+	fmt.Fprint(w, ")")
+}
+
+// Display the arguments one after another, returning ()
+func f_print(t, e L) L {
+	for ; T(t) == CONS; t = cdr(t) {
+		fdisplayExpr(os.Stdout, car(t))
+	}
+	return nilv
+}
+
+// Display the arguments one after another and a newline, returning ()
+func f_println(t, e L) L {
+	f_print(t, e)
+	fmt.Println()
+	return nilv
+}
+
+// Write an expression to be read back to the standard output or a port, returning ()
+func f_write(t, e L) L {
+	w, ok := outputPort(cdr(t))
+	if !ok {
+		return err
+	}
+	fprintExpr(w, car(t))
+	return nilv
+}
+
+// Display an expression on the standard output or a port, returning ()
+func f_display(t, e L) L {
+	w, ok := outputPort(cdr(t))
+	if !ok {
+		return err
+	}
+	fdisplayExpr(w, car(t))
+	return nilv
+}
+
+// Write a newline to the standard output or a port, returning ()
+func f_newline(t, e L) L {
+	w, ok := outputPort(t)
+	if !ok {
+		return err
+	}
+	fmt.Fprintln(w)
+	return nilv
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests for the write and display modes of the printer and the output primitives
+
+func TestWriteAndDisplay(t *testing.T) {
+	tests := []struct {
+		input   string
+		write   string
+		display string
+	}{
+		{`"a \"b\"\n"`, `"a \"b\"\n"`, "a \"b\"\n"},
+		{`#\a`, `#\a`, "a"},
+		{`#\space`, `#\space`, " "},
+		{`'(a "s" #\c 1/2)`, `(a "s" #\c 1/2)`, "(a s c 1/2)"},
+		{`(vector "x" 2)`, `#("x" 2)`, "#(x 2)"},
+		{"(exact->inexact 1/3)", precision("0.3333333333333333", "0.33333334"), precision("0.3333333333", "0.333333")},
+		{"(* 1.5 1e20)", "1.5e+20", "1.5e+20"},
+		{"123", "123", "123"},
+		{"(exact->inexact 2)", "2.0", "2.0"},
+		{`(let* (h (make-hash-table)) (_ (hash-set! h 'a "s")) h)`, `#<hash-table (a . "s")>`, "#<hash-table (a . s)>"},
+		{"(let* (h (make-hash-table 'equal)) (_ (hash-set! h '(1) 2)) h)", "#<hash-table equal ((1) . 2)>", "#<hash-table equal ((1) . 2)>"},
+	}
+	for _, tt := range tests {
+		initTinyLisp()
+		x := evalAll(tt.input)
+		var w, d strings.Builder
+		fprintExpr(&w, x)
+		fdisplayExpr(&d, x)
+		if w.String() != tt.write {
+			t.Errorf("write %s = %s, want %s", tt.input, w.String(), tt.write)
+		}
+		if d.String() != tt.display {
+			t.Errorf("display %s = %q, want %q", tt.input, d.String(), tt.display)
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	for _, input := range []string{"(exact->inexact 1/3)", "(exact->inexact 2/7)", "(* 0.1 3)", "1e300", "1.5e-7", "-0.1"} {
+		initTinyLisp()
+		x := evalAll(input)
+		var b strings.Builder
+		fprintExpr(&b, x)
+		if y := readOne(b.String()); !equ(x, y) {
+			t.Errorf("%s written as %s reads back as %s", input, b.String(), printed(y))
+		}
+	}
+}
+
+func TestOutputPrimitives(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(print "x = " 1 #\!)`, "x = 1!"},
+		{`(println "a" '(b "c"))`, "a(b c)\n"},
+		{`(println)`, "\n"},
+		{`(write "a b")`, `"a b"`},
+		{`(display "a b")`, "a b"},
+		{`(newline)`, "\n"},
+		{`(write '(1 . 2))`, "(1 . 2)"},
+	}
+	for _, tt := range tests {
+		initTinyLisp()
+		var result L
+		if out := stdout(func() { result = evalAll(tt.input) }); out != tt.expected {
+			t.Errorf("%s wrote %q, want %q", tt.input, out, tt.expected)
+		}
+		if !notv(result) {
+			t.Errorf("%s = %s, want ()", tt.input, printed(result))
+		}
+	}
+}
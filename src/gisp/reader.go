@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The reader: reads expressions one at a time from an io.Reader, looking ahead
+// no further than the next character, so the REPL, load and the read primitive
+// can share a stream with other readers of it such as read-char. Tokens have no
+// length limit. Comments are skipped like white space: ; to the end of the line,
+// #| to the matching |# and #; with the expression after it. The location of
+// every cons read is recorded in the locs table, see source.go. Errors are
+// readErrors locating the expression that could not be read.
+
+// Character returned by peek and next at the end of the input
+const eof = -1
+
+// Errors of the reader besides io.ErrUnexpectedEOF
+var (
+	errUnbalanced = errors.New("unexpected )")
+	errDot        = errors.New("malformed dotted pair")
+	errNumber     = errors.New("invalid number literal")
+	errChar       = errors.New("unknown character name")
+	errUnreadable = errors.New("unreadable object #<")
+)
+
+// readError is an error of the reader at a location in its input: where the
+// offending token starts, or where the unfinished expression starts for
+// io.ErrUnexpectedEOF
+type readError struct {
+	at  pos
+	err error
+}
+
+func (e *readError) Error() string {
+	return e.at.String() + ": " + e.err.Error()
+}
+
+func (e *readError) Unwrap() error {
+	return e.err
+}
+
+// fail returns error e located at s, unless e is already located
+func fail(s pos, e error) error {
+	if _, ok := e.(*readError); ok {
+		return e
+	}
+	return &readError{s, e}
+}
+
+// reader reads expressions from in
+type reader struct {
+	in     io.RuneScanner
+	file   string    // name of the input in locations
+	line   int       // lines read
+	col    int       // characters read on the current line
+	back   rune      // character put back by unread
+	held   bool      // back is the next character
+	busy   bool      // an expression or a comment spanning lines is being read
+	labels map[int]L // expressions by datum label in the expression being read
+	fault  error     // error of a read by the Lisp handler of a macro, see readtable.go
+}
+
+// newReader returns a reader of the expressions in r
+func newReader(r io.Reader) *reader {
+	if rs, ok := r.(io.RuneScanner); ok {
+		return &reader{in: rs}
+	}
+	return &reader{in: bufio.NewReader(r)}
+}
+
+// next reads the next character, eof at the end of the input
+func (p *reader) next() rune {
+	c := p.back
+	if p.held {
+		p.held = false
+	} else if r, _, e := p.in.ReadRune(); e == nil {
+		c = r
+	} else {
+		return eof
+	}
+	if c == '\n' {
+		p.line, p.col = p.line+1, 0
+	} else {
+		p.col++
+	}
+	return c
+}
+
+// peek returns the next character without reading it, eof at the end of the input
+func (p *reader) peek() rune {
+	if p.held {
+		return p.back
+	}
+	c, _, e := p.in.ReadRune()
+	if e != nil {
+		return eof
+	}
+	p.in.UnreadRune()
+	return c
+}
+
+// unread puts back character c, which is not a newline, read after the one peek returned last
+func (p *reader) unread(c rune) {
+	p.back, p.held = c, true
+	p.col--
+}
+
+// pos returns the location of the next character
+func (p *reader) pos() pos {
+	return pos{p.file, p.line + 1, p.col + 1}
+}
+
+// skip reads white space and comments, returning the next character
+func (p *reader) skip() (rune, error) {
+	for {
+		switch c := p.peek(); {
+		case c == ';':
+			for c != '\n' && c != eof {
+				c = p.next()
+			}
+		case c == '#':
+			s := p.pos()
+			p.next()
+			if c = p.peek(); c != '|' && c != ';' {
+				p.unread('#')
+				return '#', nil
+			}
+			p.next()
+			busy := p.busy
+			p.busy = true
+			var e error
+			if c == '|' {
+				e = p.blockComment()
+			} else {
+				_, e = p.expr()
+			}
+			p.busy = busy
+			if e != nil {
+				return eof, fail(s, e)
+			}
+		case c != eof && c <= ' ':
+			p.next()
+		default:
+			return c, nil
+		}
+	}
+}
+
+// blockComment reads a block comment after its #|, up to the matching |#
+func (p *reader) blockComment() error {
+	for depth := 1; depth > 0; {
+		switch c := p.next(); c {
+		case eof:
+			return io.ErrUnexpectedEOF
+		case '|':
+			if p.peek() == '#' {
+				p.next()
+				depth--
+			}
+		case '#':
+			if p.peek() == '|' {
+				p.next()
+				depth++
+			}
+		}
+	}
+	return nil
+}
+
+// delimiter reports whether c ends an atom
+func delimiter(c rune) bool {
+	if _, ok := macros[c]; ok {
+		return true
+	}
+	return c == eof || c <= ' ' || strings.ContainsRune("()'\";", c)
+}
+
+// read returns the next expression, io.EOF if there is none before the end of
+// the input and io.ErrUnexpectedEOF if the input ends inside one
+func (p *reader) read() (L, error) {
+	if c, e := p.skip(); e != nil {
+		return err, e
+	} else if c == eof {
+		return nilv, io.EOF
+	}
+	p.busy, p.labels = true, nil
+	defer func() { p.busy = false }()
+	return p.expr()
+}
+
+// expr reads an expression, leaving io.ErrUnexpectedEOF unlocated if the input
+// ends before it so that the enclosing expression is reported
+func (p *reader) expr() (L, error) {
+	c, e := p.skip()
+	if e != nil {
+		return err, e
+	}
+	s := p.pos()
+	var x L
+	switch c {
+	case eof:
+		return err, io.ErrUnexpectedEOF
+	case ')':
+		p.next()
+		e = errUnbalanced
+	case '(':
+		p.next()
+		x, e = p.list(s)
+	case '\'':
+		p.next()
+		if x, e = p.expr(); e == nil {
+			x = locate(cons(atom("quote"), cons(x, nilv)), s)
+		}
+	case '"':
+		p.next()
+		x, e = p.readString()
+	case '#':
+		p.next()
+		switch p.peek() {
+		case '\\':
+			p.next()
+			x, e = p.readChar()
+		case '(':
+			p.next()
+			if x, e = p.list(s); e == nil {
+				x = listVector(x)
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			x, e = p.label()
+		default:
+			if m, ok := dispatches[p.peek()]; ok {
+				x, e = m(p, p.next())
+			} else if p.peek() == '<' {
+				e = errUnreadable
+			} else {
+				x, e = p.atom("#")
+			}
+		}
+	default:
+		if m, ok := macros[c]; ok {
+			x, e = m(p, p.next())
+		} else {
+			x, e = p.atom("")
+		}
+	}
+	if e != nil {
+		return err, fail(s, e)
+	}
+	return x, nil
+}
+
+// list reads the elements of a list after its opening parenthesis at s
+func (p *reader) list(s pos) (L, error) {
+	var xs []L
+	t := nilv
+	for {
+		c, e := p.skip()
+		if e != nil {
+			return err, e
+		} else if c == ')' {
+			p.next()
+			break
+		} else if c == eof {
+			return err, io.ErrUnexpectedEOF
+		} else if c == '.' {
+			d := p.pos()
+			p.next()
+			if !delimiter(p.peek()) {
+				x, e := p.atom(".")
+				if e != nil {
+					return err, fail(d, e)
+				}
+				xs = append(xs, x)
+				continue
+			}
+			if c, e = p.skip(); e != nil {
+				return err, e
+			} else if len(xs) == 0 || c == ')' {
+				return err, fail(d, errDot)
+			}
+			x, e := p.expr()
+			if e != nil {
+				return err, e
+			}
+			t = x
+			if c, e = p.skip(); e != nil {
+				return err, e
+			} else if c != ')' && c != eof {
+				return err, fail(p.pos(), errDot)
+			} else if c == eof {
+				return err, io.ErrUnexpectedEOF
+			}
+			p.next()
+			break
+		}
+		x, e := p.expr()
+		if e != nil {
+			return err, e
+		}
+		xs = append(xs, x)
+	}
+	for i := len(xs) - 1; i >= 0; i-- {
+		t = cons(xs[i], t)
+	}
+	if T(t) == CONS {
+		locate(t, s)
+	}
+	return t, nil
+}
+
+// atom reads the rest of an atom or number that starts with prefix, errNumber
+// if it starts like a number but is not one
+func (p *reader) atom(prefix string) (L, error) {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for !delimiter(p.peek()) {
+		b.WriteRune(p.next())
+	}
+	s := b.String()
+	if n, ok := parseNumber(s); ok {
+		return n, nil
+	} else if numeral(s) {
+		return err, fmt.Errorf("%w %s", errNumber, s)
+	}
+	return atom(s), nil
+}
+
+// numeral reports whether s starts like a number: with a digit after an
+// optional sign and point, or with a radix prefix
+func numeral(s string) bool {
+	if len(s) > 2 && s[0] == '#' && radixes[s[1]|0x20] > 0 {
+		return true
+	}
+	s = strings.TrimPrefix(strings.TrimLeft(s, "+-"), ".")
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// Read an expression from an optional string or the standard input, () at the end
+// of the input, or the next expression in a reader macro
+func f_read(t, e L) L {
+	if macroReader != nil && T(t) != CONS {
+		return readMacro((*reader).expr)
+	}
+	p := newReader(rdr)
+	if T(car(t)) == STRG {
+		p = newReader(strings.NewReader(text(car(t))))
+	} else if T(t) == CONS {
+		return err
+	}
+	x, e2 := p.read()
+	if e2 == io.EOF {
+		return nilv
+	} else if e2 != nil {
+		return err
+	}
+	return x
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Readtable: reader macros extend the syntax of the reader. A macro character
+// starts an expression that its handler reads and ends an atom before it, and a
+// dispatch character does the same after #. Handlers are Go functions given the
+// reader, or Lisp functions called with the character, which read the rest of
+// the expression with read-char, peek-char, read and read-delimited-list from
+// the reader running them. A macro character without a handler closes what an
+// opening one reads up to, like ] after [.
+
+// macro reads the expression after character c
+type macro func(p *reader, c rune) (L, error)
+
+var (
+	macros      map[rune]macro // handlers of the macro characters
+	dispatches  map[rune]macro // handlers of the characters after #
+	macroReader *reader        // the reader running a Lisp handler, nil if none
+)
+
+// Error of a Lisp handler that returns ERR
+var errMacro = errors.New("reader macro failed")
+
+// setMacro makes c a macro character read by m
+func setMacro(c rune, m macro) {
+	if macros == nil {
+		macros = make(map[rune]macro)
+	}
+	macros[c] = m
+}
+
+// setDispatch makes #c read by m
+func setDispatch(c rune, m macro) {
+	if dispatches == nil {
+		dispatches = make(map[rune]macro)
+	}
+	dispatches[c] = m
+}
+
+// closing reads a macro character without a handler, which closes no expression here
+func closing(p *reader, c rune) (L, error) {
+	return err, fmt.Errorf("unexpected %c", c)
+}
+
+// lispMacro returns a macro calling Lisp function f with the character
+func lispMacro(f L) macro {
+	return func(p *reader, c rune) (L, error) {
+		saved := macroReader
+		macroReader, p.fault = p, nil
+		x := invoke(f, cons(char(c), nilv))
+		macroReader = saved
+		if e := p.fault; e != nil {
+			p.fault = nil
+			return err, e
+		} else if equ(x, err) {
+			return err, errMacro
+		}
+		return x, nil
+	}
+}
+
+// delimited reads the expressions up to character end, returning their list
+func (p *reader) delimited(end rune) (L, error) {
+	var xs []L
+	for {
+		c, e := p.skip()
+		if e != nil {
+			return err, e
+		} else if c == end {
+			p.next()
+			return listOf(xs), nil
+		} else if c == eof {
+			return err, io.ErrUnexpectedEOF
+		}
+		x, e := p.expr()
+		if e != nil {
+			return err, e
+		}
+		xs = append(xs, x)
+	}
+}
+
+// readMacro reads from the reader running a Lisp handler with f, recording an
+// error for the handler to return
+func readMacro(f func(p *reader) (L, error)) L {
+	p := macroReader
+	if p == nil {
+		return err
+	}
+	x, e := f(p)
+	if e != nil {
+		if p.fault == nil {
+			p.fault = e
+		}
+		return err
+	}
+	return x
+}
+
+// Make a character a macro character read by a function of the character, or closing if the function is ()
+func f_set_macro_character(t, e L) L {
+	c, f := car(t), car(cdr(t))
+	if T(c) != CHAR || rune(ord(c)) <= ' ' || strings.ContainsRune("()\";'#", rune(ord(c))) {
+		return err
+	}
+	if notv(f) {
+		setMacro(rune(ord(c)), closing)
+	} else {
+		setMacro(rune(ord(c)), lispMacro(f))
+	}
+	retain(f)
+	return c
+}
+
+// Make # followed by a character read by a function of the character
+func f_set_dispatch_macro_character(t, e L) L {
+	c, f := car(t), car(cdr(t))
+	if T(c) != CHAR || rune(ord(c)) <= ' ' || strings.ContainsRune("\\(|;0123456789", rune(ord(c))) {
+		return err
+	}
+	setDispatch(rune(ord(c)), lispMacro(f))
+	retain(f)
+	return c
+}
+
+// Read the list of expressions up to a character, in a reader macro
+func f_read_delimited_list(t, e L) L {
+	if T(car(t)) != CHAR {
+		return err
+	}
+	return readMacro(func(p *reader) (L, error) { return p.delimited(rune(ord(car(t)))) })
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Tests for reader macros
+
+// readErr returns the error of reading input
+func readErr(input string) error {
+	_, e := newReader(strings.NewReader(input)).read()
+	return e
+}
+
+func TestGoReaderMacro(t *testing.T) {
+	initTinyLisp()
+	setMacro('[', func(p *reader, c rune) (L, error) {
+		t, e := p.delimited(']')
+		if e != nil {
+			return err, e
+		}
+		return listVector(t), nil
+	})
+	setMacro(']', closing)
+	x := readOne("(a[1 [2] b]c)")
+	if s := printed(x); s != "(a #(1 #(2) b) c)" {
+		t.Errorf("(a[1 [2] b]c) read as %s, want (a #(1 #(2) b) c)", s)
+	}
+	if e := readErr("[1 2"); !errors.Is(e, io.ErrUnexpectedEOF) || e.Error() != "1:1: unexpected EOF" {
+		t.Errorf("an unclosed [ should be reported where it starts, got %v", e)
+	}
+	if e := readErr("(1 ] 2)"); e == nil || e.Error() != "1:4: unexpected ]" {
+		t.Errorf("a ] closing nothing should be reported, got %v", e)
+	}
+}
+
+func TestLispReaderMacro(t *testing.T) {
+	initTinyLisp()
+	evalAll(`(set-macro-character #\] ())
+(set-macro-character #\[ (lambda (c) (list->vector (read-delimited-list #\]))))`)
+	gc()
+	if s := printed(readOne("[1 (a b) [\"s\"]]")); s != `#(1 (a b) #("s"))` {
+		t.Errorf("a Lisp macro for [ should read vectors, got %s", s)
+	}
+	if x := evalAll("(vector-length [1 2 3])"); !equ(x, L(3)) {
+		t.Error("the macro should apply to the expressions evaluated")
+	}
+}
+
+func TestDispatchMacro(t *testing.T) {
+	initTinyLisp()
+	evalAll(`(set-dispatch-macro-character #\! (lambda (c) (cons 'bang (cons (read) ()))))
+(set-dispatch-macro-character #\$ (lambda (c) (cons (read-char) (cons (peek-char) (cons (read-char) ())))))`)
+	if s := printed(readOne("(#!(x y) #t)")); s != "((bang (x y)) #t)" {
+		t.Errorf("#! should be read by its handler, got %s", s)
+	}
+	if s := printed(readOne("#$ab")); s != `(#\a #\b #\b)` {
+		t.Errorf("read-char and peek-char should read from the reader in a macro, got %s", s)
+	}
+	if x := readOne("#x1f"); !equ(x, L(31)) {
+		t.Error("#x numbers should still be read")
+	}
+}
+
+func TestReaderMacroErrors(t *testing.T) {
+	initTinyLisp()
+	evalAll(`(set-macro-character #\! (lambda (c) (car c)))
+(set-macro-character #\% (lambda (c) (read-delimited-list #\%)))`)
+	if e := readErr("(a !b)"); !errors.Is(e, errMacro) || e.Error() != "1:4: reader macro failed" {
+		t.Errorf("a handler returning ERR should be reported, got %v", e)
+	}
+	if e := readErr("(a %b c"); !errors.Is(e, io.ErrUnexpectedEOF) {
+		t.Errorf("the end of the input in a handler should be reported, got %v", e)
+	}
+	for _, input := range []string{`(set-macro-character #\( car)`, `(set-macro-character #\space car)`,
+		`(set-dispatch-macro-character #\( car)`, `(set-dispatch-macro-character #\1 car)`, "(read-delimited-list #\\))"} {
+		if x := evalAll(input); !equ(x, err) {
+			t.Errorf("%s = %s, want ERR", input, printed(x))
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import "strings"
+
+// Records: instances of the record types made by define-record-type, allocated
+// on the stack like vectors and boxed with the RECD tag. The first cell holds
+// the index of the type in the rtypes table, the fields follow. The constructor,
+// predicate, accessors and modifiers of a type are primitives made when the
+// type is defined.
+
+// rtype is a record type
+type rtype struct {
+	name   string
+	fields []L
+}
+
+// Record types by index
+var rtypes []*rtype
+
+// record allocates a record of type k with its fields set to ()
+func record(k int) L {
+	n := len(rtypes[k].fields)
+	if I(n)+1 > sp || hp > (sp-I(n)-1)*cellSize {
+		panic("out of memory")
+	}
+	sp -= I(n) + 1
+	cell[sp] = L(k)
+	for i := sp + 1; i <= sp+I(n); i++ {
+		cell[i] = nilv
+	}
+	return box(RECD, sp)
+}
+
+// rtypeOf returns the type of record r
+func rtypeOf(r L) *rtype {
+	return rtypes[int(cell[ord(r)])]
+}
+
+// field returns the index in cell of field i of r, false if r is not a record of type k
+func field(r L, k, i int) (I, bool) {
+	if T(r) != RECD || int(cell[ord(r)]) != k {
+		return 0, false
+	}
+	return ord(r) + 1 + I(i), true
+}
+
+// defineRecordPrim binds v to a new primitive f
+func defineRecordPrim(v L, f func(t, e L) L) {
+	primTab = append(primTab, prim{name(v), f, false})
+	define(v, entry(PRIM, len(primTab)))
+}
+
+// (define-record-type <name> (constructor field ...) predicate (field accessor [modifier]) ...)
+// defines a record type with its primitives, returning the name
+func f_define_record_type(t, e L) L {
+	k := len(rtypes)
+	rt := &rtype{name: strings.TrimSuffix(strings.TrimPrefix(name(car(t)), "<"), ">")}
+	specs := cdr(cdr(cdr(t)))
+	for s := specs; T(s) == CONS; s = cdr(s) {
+		rt.fields = append(rt.fields, car(car(s)))
+	}
+	index := func(f L) int {
+		for i, g := range rt.fields {
+			if equ(f, g) {
+				return i
+			}
+		}
+		return -1
+	}
+	ctor := car(cdr(t))
+	var args []int
+	if T(ctor) == ATOM {
+		for i := range rt.fields {
+			args = append(args, i)
+		}
+	} else {
+		for f := cdr(ctor); T(f) == CONS; f = cdr(f) {
+			if args = append(args, index(car(f))); args[len(args)-1] < 0 {
+				return err
+			}
+		}
+		ctor = car(ctor)
+	}
+	rtypes = append(rtypes, rt)
+	defineRecordPrim(ctor, func(t, e L) L {
+		r := record(k)
+		for _, i := range args {
+			cell[ord(r)+1+I(i)] = car(t)
+			t = cdr(t)
+		}
+		return r
+	})
+	defineRecordPrim(car(cdr(cdr(t))), func(t, e L) L {
+		if _, ok := field(car(t), k, 0); ok {
+			return tru
+		}
+		return nilv
+	})
+	for s := specs; T(s) == CONS; s = cdr(s) {
+		i := index(car(car(s)))
+		defineRecordPrim(car(cdr(car(s))), func(t, e L) L {
+			if j, ok := field(car(t), k, i); ok {
+				return cell[j]
+			}
+			return err
+		})
+		if m := cdr(cdr(car(s))); T(m) == CONS {
+			defineRecordPrim(car(m), func(t, e L) L {
+				j, ok := field(car(t), k, i)
+				if !ok {
+					return err
+				}
+				cell[j] = car(cdr(t))
+				retain(cell[j])
+				return cell[j]
+			})
+		}
+	}
+	return car(t)
+}
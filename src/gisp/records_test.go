@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+// Tests for the records in records.go
+
+// printed returns x as printed by printExpr
+func printed(x L) string {
+	return stdout(func() { printExpr(x) })
+}
+
+func TestRecords(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected L
+	}{
+		{"(point-x p)", 1},
+		{"(point-y p)", 2},
+		{"(let* (_ (set-point-x! p 5)) (point-x p))", 5},
+		{"(point? p)", tru},
+		{"(point? '(1 2))", nilv},
+		{"(point? #(1 2))", nilv},
+		{"(pair? p)", nilv},
+		{"(point-x '(1 2))", err},
+		{"(point-x (make-segment p p))", err},
+		{"(point-x (segment-from (make-segment p 3)))", 1},
+		{"(segment-to (make-segment p 3))", 3},
+		{"(define-record-type bad (make-bad z) bad? (x bad-x))", err},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			evalAll(`(define-record-type <point> (make-point x y) point? (x point-x set-point-x!) (y point-y))
+				(define-record-type segment (make-segment from to) segment? (from segment-from) (to segment-to))
+				(define p (make-point 1 2))`)
+			if result := evalAll(tt.input); !equ(result, tt.expected) {
+				t.Errorf("%s = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRecordConstructorFields(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define-record-type node (make-node next) node? (value node-value set-node-value!) (next node-next))")
+	if result := evalAll("(node-value (make-node 3))"); !notv(result) {
+		t.Error("a field the constructor does not set should be ()")
+	}
+	if result := evalAll("(node-next (make-node 3))"); !equ(result, L(3)) {
+		t.Error("the constructor should set the fields it names")
+	}
+}
+
+func TestRecordPrinting(t *testing.T) {
+	initTinyLisp()
+	x := evalAll(`(define-record-type <point> (make-point x y) point? (x point-x) (y point-y))
+		(make-point 1 '(2 "b"))`)
+	if got := printed(x); got != `#<point x: 1 y: (2 "b")>` {
+		t.Errorf("record prints as %s", got)
+	}
+}
+
+func TestRecordsVM(t *testing.T) {
+	initTinyLisp()
+	result := runAll(`(define-record-type <point> (make-point x y) point? (x point-x set-point-x!) (y point-y))
+		(define p (make-point 1 2))
+		(define f (lambda (q) (+ (point-x q) (point-y q))))
+		(set-point-x! p 5)
+		(f p)`)
+	if !equ(result, L(7)) {
+		t.Errorf("record access on the VM = %v, want 7", result)
+	}
+}
+
+func TestRecordRedefinition(t *testing.T) {
+	const input = `(define-record-type pt (mk x y) pt? (x px) (y py))
+		(define f (lambda (p) (px p)))
+		(f (mk 1 2))
+		(define-record-type pt (mk x y) pt? (x px) (y py))
+		(f (mk 3 4))`
+	initTinyLisp()
+	if result := evalAll(input); !equ(result, L(3)) {
+		t.Errorf("a function should call the accessor of a redefined record type, got %v", result)
+	}
+	initTinyLisp()
+	if result := runAll(input); !equ(result, L(3)) {
+		t.Errorf("a function on the VM should call the accessor of a redefined record type, got %v", result)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The REPL reads expressions from a console over the standard input, which
+// prompts whenever the reader needs another line: with the free memory before
+// a new expression and with a continuation prompt inside one. Every expression
+// on a line is evaluated in turn.
+
+// Prompt shown while reading the rest of an expression
+const more = "... "
+
+// console reads runes from in, calling prompt before reading each line
+type console struct {
+	in       *bufio.Reader
+	prompt   func()
+	bol      bool // the next rune starts a line
+	prompted bool // a prompt was shown since begin
+}
+
+// begin starts reading an expression
+func (c *console) begin() {
+	c.prompted = false
+}
+
+func (c *console) ReadRune() (rune, int, error) {
+	if c.bol {
+		c.prompt()
+		c.bol, c.prompted = false, true
+	}
+	r, n, e := c.in.ReadRune()
+	if e == nil {
+		c.bol = r == '\n'
+	}
+	return r, n, e
+}
+
+func (c *console) UnreadRune() error {
+	c.bol = false
+	return c.in.UnreadRune()
+}
+
+// repl reads, evaluates and prints the expressions in rdr until its end
+func repl() {
+	c := &console{in: rdr, bol: true}
+	in := &reader{in: c, file: "stdin"}
+	c.prompt = func() {
+		if in.busy {
+			fmt.Print(more)
+		} else {
+			fmt.Printf("\n%d> ", int(sp)-int(hp)/cellSize)
+		}
+	}
+	for {
+		c.begin()
+		expr, e := in.read()
+		if e == io.EOF {
+			break
+		} else if !c.prompted {
+			fmt.Println() // another expression on the same line
+		}
+		if e != nil {
+			fmt.Print(e)
+			if errors.Is(e, io.ErrUnexpectedEOF) {
+				break
+			}
+			// Skip the rest of the line through the reader, which counts it in its locations
+			for !c.bol && in.next() != eof {
+			}
+			continue
+		}
+		clearFailure()
+		calls = calls[:0]
+		x := run(expr)
+		if conf.width > 0 {
+			PrettyPrint(os.Stdout, x, conf.width)
+		} else {
+			printExpr(x)
+		}
+		if equ(x, err) || equ(x, atom("EVAL-ERROR")) || equ(x, atom("PARSE-ERROR")) {
+			report()
+		}
+		gc()
+	}
+}
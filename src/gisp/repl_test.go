@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests for the REPL in repl.go
+
+// stdout returns what f writes to the standard output
+func stdout(f func()) string {
+	r, w, _ := os.Pipe()
+	saved := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	f()
+	os.Stdout = saved
+	w.Close()
+	return <-done
+}
+
+// session returns the output of the REPL reading input
+func session(input string) string {
+	initTinyLisp()
+	saved := rdr
+	defer func() { rdr = saved }()
+	rdr = bufio.NewReader(strings.NewReader(input))
+	return stdout(repl)
+}
+
+func TestREPLMultiLine(t *testing.T) {
+	out := session("(define sq\n  (lambda (x)\n    (* x x)))\n(sq 3)\n")
+	if strings.Count(out, more) != 2 {
+		t.Errorf("a define over three lines should show two continuation prompts:\n%s", out)
+	}
+	if !strings.Contains(out, "> 9\n") {
+		t.Errorf("the function defined over several lines should be callable:\n%s", out)
+	}
+}
+
+func TestREPLExpressionsOnALine(t *testing.T) {
+	out := session("(define a 1) (+ a 1) (+ a 2)\n")
+	if !strings.Contains(out, "a\n2\n3") {
+		t.Errorf("every expression on a line should be evaluated in order:\n%s", out)
+	}
+	if strings.Count(out, ">") != 2 {
+		t.Errorf("expressions on one line should not be prompted for:\n%s", out)
+	}
+}
+
+func TestREPLErrors(t *testing.T) {
+	out := session("1)\n2\n(3")
+	if !strings.Contains(out, "1\nstdin:1:2: "+errUnbalanced.Error()) || !strings.Contains(out, "> 2") {
+		t.Errorf("an unbalanced ) should be reported and reading should go on:\n%s", out)
+	}
+	if !strings.HasSuffix(out, io.ErrUnexpectedEOF.Error()) {
+		t.Errorf("an expression cut off by the end of the input should be reported:\n%s", out)
+	}
+}
+
+func TestREPLErrorLocations(t *testing.T) {
+	out := session("(a . b c) (x\n(car 1)\n")
+	if !strings.Contains(out, "stdin:1:8: malformed dotted pair") || !strings.Contains(out, "ERR from stdin:2:1: (car 1)") {
+		t.Errorf("locations should count the line skipped after a read error:\n%s", out)
+	}
+}
+
+func TestREPLComments(t *testing.T) {
+	out := session("; a comment\n#| a block\ncomment |# (+ 1 ; one\n 2)\n")
+	if strings.Count(out, more) != 2 || !strings.Contains(out, "... 3") {
+		t.Errorf("comments should be skipped, with continuation prompts inside a block comment:\n%s", out)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Source locations: the reader records the file, line and column of every cons
+// it reads in the locs table, keyed by cell index so that the boxed values stay
+// the same. gc forgets the locations of the cells it frees. When a form makes
+// ERR from arguments that are not ERR, the form is recorded with the calls
+// being evaluated, so the REPL and load can report where the error arose.
+
+// pos is a location in a source
+type pos struct {
+	file string
+	line int
+	col  int
+}
+
+func (s pos) String() string {
+	if s.file == "" {
+		return strconv.Itoa(s.line) + ":" + strconv.Itoa(s.col)
+	}
+	return s.file + ":" + strconv.Itoa(s.line) + ":" + strconv.Itoa(s.col)
+}
+
+// Locations of conses by cell index
+var locs map[I]pos
+
+// locate records that cons x was read at s, returning x
+func locate(x L, s pos) L {
+	locs[ord(x)] = s
+	return x
+}
+
+// relocate gives y the location of x if y is a cons without one, returning y
+func relocate(y, x L) L {
+	if s, ok := locs[ord(x)]; ok && T(x) == CONS && T(y) == CONS {
+		if _, ok := locs[ord(y)]; !ok {
+			locs[ord(y)] = s
+		}
+	}
+	return y
+}
+
+// where returns the location of x, "" if x was not read
+func where(x L) string {
+	if s, ok := locs[ord(x)]; ok && T(x) == CONS {
+		return s.String()
+	}
+	return ""
+}
+
+// forget drops the locations of the cells below top, which gc frees
+func forget() {
+	for i := range locs {
+		if i < top {
+			delete(locs, i)
+		}
+	}
+}
+
+var (
+	failure   L     // the form that made ERR last, () if none
+	misread   error // the reader error that stopped the latest load, nil if none
+	backtrace []L   // the calls being evaluated when failure was recorded, outermost first
+	calls     []L   // the calls of closures being evaluated, outermost first
+	tracing   bool  // print calls of closures as they are made
+)
+
+// clearFailure forgets the latest failure before evaluating a top-level form
+func clearFailure() {
+	failure, misread, backtrace = nilv, nil, backtrace[:0]
+}
+
+// failed records call x of f as the failure if it made ERR from the arguments
+// t, rather than passing on an ERR from an argument or a closure body
+func failed(x, f, t L) {
+	for a := cdr(x); T(t) == CONS; a, t = cdr(a), cdr(t) {
+		if equ(car(t), err) {
+			if T(car(a)) != ATOM {
+				return
+			}
+			break
+		}
+	}
+	if T(t) != CONS && T(f) == CLOS {
+		return
+	}
+	failure = x
+	backtrace = append(backtrace[:0], calls...)
+}
+
+// enterCall notes that call x of f is being evaluated, tracing it if f is a
+// closure, and returns the number of calls before it
+func enterCall(x, f L) int {
+	n := len(calls)
+	if T(f) == CLOS && T(x) == CONS {
+		if tracing {
+			trace(x, n)
+		}
+		calls = append(calls, x)
+	}
+	return n
+}
+
+// called applies f to the arguments t for call x, recording the call while f runs
+func called(x, f, t L) L {
+	n := enterCall(x, f)
+	y := invoke(f, t)
+	calls = calls[:n]
+	if equ(y, err) && T(x) == CONS {
+		failed(x, f, t)
+	}
+	return y
+}
+
+// trace prints call x at depth n of the calls being evaluated
+func trace(x L, n int) {
+	fmt.Printf("%*s", 2*n, "")
+	if s := where(x); s != "" {
+		fmt.Print(s, ": ")
+	}
+	printExpr(x)
+	fmt.Println()
+}
+
+// report prints the reader error of the latest load, or the latest failure and
+// its backtrace, innermost call first, each on a new line
+func report() {
+	if misread != nil {
+		fmt.Print("\n", misread)
+		return
+	} else if notv(failure) {
+		return
+	}
+	fmt.Print("\nERR from ")
+	printAt(failure)
+	for i := len(backtrace) - 1; i >= 0; i-- {
+		fmt.Print("\n  in ")
+		printAt(backtrace[i])
+	}
+}
+
+// printAt prints form x after its location
+func printAt(x L) {
+	if s := where(x); s != "" {
+		fmt.Print(s, ": ")
+	}
+	printExpr(x)
+}
+
+// Print calls of closures as they are made if the argument is not (), returning the argument
+func f_trace(t, e L) L {
+	tracing = !notv(car(t))
+	return car(t)
+}
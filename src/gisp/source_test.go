@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests for source locations, error reports and traces
+
+func TestReadLocations(t *testing.T) {
+	initTinyLisp()
+	p := newReader(strings.NewReader("\n(define f\n  (lambda (x) '(x)))"))
+	p.file = "f.lisp"
+	x, _ := p.read()
+	lambda := car(cdr(cdr(x)))
+	tests := []struct {
+		x    L
+		want string
+	}{
+		{x, "f.lisp:2:1"},
+		{lambda, "f.lisp:3:3"},
+		{car(cdr(lambda)), "f.lisp:3:11"},
+		{car(cdr(cdr(lambda))), "f.lisp:3:15"},
+		{car(x), ""},
+	}
+	for _, test := range tests {
+		if s := where(test.x); s != test.want {
+			t.Errorf("location of %s = %q, want %q", printed(test.x), s, test.want)
+		}
+	}
+}
+
+func TestFailureBacktrace(t *testing.T) {
+	for _, vm := range []bool{false, true} {
+		initTinyLisp()
+		eval := evalAll
+		if vm {
+			eval = runAll
+		}
+		eval("(define f (lambda (x) (car x)))\n(define g (lambda (y) (+ 1 (f y))))")
+		clearFailure()
+		if result := eval("(g 5)"); !equ(result, err) {
+			t.Fatalf("(g 5) = %s, want ERR", printed(result))
+		}
+		if where(failure) != "1:23" || printed(failure) != "(car x)" {
+			t.Errorf("vm %v: failure at %s: %s, want 1:23: (car x)", vm, where(failure), printed(failure))
+		}
+		if n := len(backtrace); n == 0 || printed(backtrace[0]) != "(g 5)" {
+			t.Errorf("vm %v: the backtrace should start at (g 5): %d calls", vm, n)
+		}
+		if len(calls) != 0 {
+			t.Errorf("vm %v: %d calls left after evaluation, want 0", vm, len(calls))
+		}
+	}
+}
+
+func TestFailurePassedOn(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define f (lambda (x) (car x)))")
+	clearFailure()
+	evalAll("(+ 1 (f 2))")
+	if printed(failure) != "(car x)" {
+		t.Errorf("an ERR passed on as an argument should keep the failure where it arose, got %s", printed(failure))
+	}
+	clearFailure()
+	evalAll("(+ 1 undefined)")
+	if printed(failure) != "(+ 1 undefined)" {
+		t.Errorf("an undefined variable should fail the form using it, got %s", printed(failure))
+	}
+}
+
+func TestREPLReportsLocation(t *testing.T) {
+	out := session("(define f (lambda (x)\n  (car x)))\n(f 1)\n")
+	want := "ERR\nERR from stdin:2:3: (car x)\n  in stdin:3:1: (f 1)"
+	if !strings.Contains(out, want) {
+		t.Errorf("the REPL should report where ERR arose:\n%s", out)
+	}
+}
+
+func TestLoadReportsLocation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bad.lisp")
+	os.WriteFile(file, []byte("(define f (lambda (x) (car x)))\n\n(f 7)\n"), 0o644)
+	out := session(`(load "` + file + `")` + "\n")
+	want := "EVAL-ERROR\nERR from " + file + ":1:23: (car x)\n  in " + file + ":3:1: (f 7)"
+	if !strings.Contains(out, want) {
+		t.Errorf("load should report the file, line and column of the failure:\n%s", out)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	out := session("(define f (lambda (n) (if (< n 1) 0 (+ 1 (f (- n 1))))))\n(trace #t)\n(f 2)\n(trace ())\n(f 2)\n")
+	want := "stdin:3:1: (f 2)\n  stdin:1:42: (f (- n 1))\n    stdin:1:42: (f (- n 1))\n2"
+	if !strings.Contains(out, want) {
+		t.Errorf("trace should print each call indented by depth:\n%s", out)
+	}
+	if strings.Count(out, "(f (- n 1))") != 2 {
+		t.Errorf("(trace ()) should stop tracing:\n%s", out)
+	}
+}
+
+func TestGCForgetsLocations(t *testing.T) {
+	initTinyLisp()
+	p := newReader(strings.NewReader("(a b) (c d)"))
+	p.read()
+	keep()
+	x, _ := p.read()
+	gc()
+	if where(x) != "" {
+		t.Error("gc should forget the locations of the cells it frees")
+	}
+	for i := range locs {
+		if i < top {
+			t.Errorf("location of freed cell %d kept", i)
+		}
+	}
+}
+
+func TestLoadReportsReadError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "broken.lisp")
+	os.WriteFile(file, []byte("(define a 1)\n(define b (+ a 2x))\n"), 0o644)
+	out := session(`(load "` + file + `")` + "\n(+ a 1)\n")
+	want := "PARSE-ERROR\n" + file + ":2:16: invalid number literal 2x"
+	if !strings.Contains(out, want) {
+		t.Errorf("load should report the reader error with its location:\n%s", out)
+	}
+	if !strings.Contains(out, "> 2") {
+		t.Errorf("the forms before the reader error should be loaded:\n%s", out)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strings: immutable text boxed with the STRG tag, indexing the strs table.
+// Unlike atoms they are not interned, and like the cells they are freed by gc
+// when they were created after the latest define.
+
+// Strings by index, and the number of strings after the latest define
+var (
+	strs   []string
+	strtop int
+)
+
+// str returns a new string holding s
+func str(s string) L {
+	strs = append(strs, s)
+	return entry(STRG, len(strs))
+}
+
+// text returns the Go string of string x
+func text(x L) string {
+	return strs[ord(x)]
+}
+
+// name returns the name of atom x
+func name(x L) string {
+	i := ord(x)
+	j := i
+	for A[j] != 0 {
+		j++
+	}
+	return string(A[i:j])
+}
+
+// quote returns s in string literal syntax
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\t':
+			b.WriteString("\\t")
+		case '\r':
+			b.WriteString("\\r")
+		case 0:
+			b.WriteString("\\0")
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// readString reads a string literal after its opening quote
+func (p *reader) readString() (L, error) {
+	var b strings.Builder
+	for c := p.next(); c != '"'; c = p.next() {
+		if c == '\\' {
+			switch c = p.next(); c {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case 'r':
+				c = '\r'
+			case '0':
+				c = 0
+			}
+		}
+		if c == eof {
+			return err, io.ErrUnexpectedEOF
+		}
+		b.WriteRune(c)
+	}
+	return str(b.String()), nil
+}
+
+// stringArgs returns the Go strings of the strings in list t, false if t holds anything else
+func stringArgs(t L) ([]string, bool) {
+	var ss []string
+	for ; T(t) == CONS; t = cdr(t) {
+		if T(car(t)) != STRG {
+			return nil, false
+		}
+		ss = append(ss, text(car(t)))
+	}
+	return ss, true
+}
+
+// Return #t if the argument is a string
+func f_stringp(t, e L) L {
+	if T(car(t)) == STRG {
+		return tru
+	}
+	return nilv
+}
+
+// Return the number of characters of a string
+func f_string_length(t, e L) L {
+	if T(car(t)) != STRG {
+		return err
+	}
+	return L(utf8.RuneCountInString(text(car(t))))
+}
+
+// Return the characters of a string from a start index up to an optional end index
+func f_substring(t, e L) L {
+	if T(car(t)) != STRG {
+		return err
+	}
+	r := []rune(text(car(t)))
+	i, j := car(cdr(t)), L(len(r))
+	if x := cdr(cdr(t)); T(x) == CONS {
+		j = car(x)
+	}
+	if !(i >= 0 && i <= j && j <= L(len(r))) {
+		return err
+	}
+	return str(string(r[int(i):int(j)]))
+}
+
+// Concatenate strings
+func f_string_append(t, e L) L {
+	ss, ok := stringArgs(t)
+	if !ok {
+		return err
+	}
+	return str(strings.Join(ss, ""))
+}
+
+// Return the atom named by a string
+func f_string_symbol(t, e L) L {
+	if T(car(t)) != STRG || text(car(t)) == "" {
+		return err
+	}
+	return atom(text(car(t)))
+}
+
+// Return the name of an atom as a string
+func f_symbol_string(t, e L) L {
+	if T(car(t)) != ATOM {
+		return err
+	}
+	return str(name(car(t)))
+}
+
+// Return a number as a string, in an optional base from 2 to 36
+func f_number_string(t, e L) L {
+	b := L(10)
+	if T(cdr(t)) == CONS {
+		b = car(cdr(t))
+	}
+	if !numeric(car(t)) || !small(b) || b < 2 || b > 36 {
+		return err
+	}
+	if s, ok := formatRadix(car(t), int(b)); ok {
+		return str(s)
+	}
+	return err
+}
+
+// Return the number a string denotes as the reader reads it, or () if it is not a number
+func f_string_number(t, e L) L {
+	if T(car(t)) != STRG {
+		return err
+	}
+	if s := strings.TrimSpace(text(car(t))); numeral(s) {
+		if n, ok := parseNumber(s); ok {
+			return n
+		}
+	}
+	return nilv
+}
+
+// Split a string at a separator, or at white space without one, into a list of strings
+func f_string_split(t, e L) L {
+	ss, ok := stringArgs(t)
+	if !ok || len(ss) == 0 {
+		return err
+	}
+	var parts []string
+	if len(ss) > 1 {
+		parts = strings.Split(ss[0], ss[1])
+	} else {
+		parts = strings.Fields(ss[0])
+	}
+	xs := make([]L, len(parts))
+	for i, s := range parts {
+		xs[i] = str(s)
+	}
+	return listOf(xs)
+}
+
+// Join a list of strings with an optional separator
+func f_string_join(t, e L) L {
+	ss, ok := stringArgs(car(t))
+	sep, ok2 := stringArgs(cdr(t))
+	if !ok || !ok2 {
+		return err
+	}
+	return str(strings.Join(ss, strings.Join(sep, "")))
+}
+
+// Convert a string to upper case
+func f_string_upcase(t, e L) L {
+	if T(car(t)) != STRG {
+		return err
+	}
+	return str(strings.ToUpper(text(car(t))))
+}
+
+// Convert a string to lower case
+func f_string_downcase(t, e L) L {
+	if T(car(t)) != STRG {
+		return err
+	}
+	return str(strings.ToLower(text(car(t))))
+}
+
+// compare returns a primitive that checks that each string argument is ordered
+// before the next one by ok, given the result of strings.Compare
+func compare(ok func(int) bool) func(t, e L) L {
+	return func(t, e L) L {
+		ss, valid := stringArgs(t)
+		if !valid {
+			return err
+		}
+		for i := 1; i < len(ss); i++ {
+			if !ok(strings.Compare(ss[i-1], ss[i])) {
+				return nilv
+			}
+		}
+		return tru
+	}
+}
+
+// String comparisons
+var (
+	f_string_eq = compare(func(c int) bool { return c == 0 })
+	f_string_lt = compare(func(c int) bool { return c < 0 })
+	f_string_gt = compare(func(c int) bool { return c > 0 })
+	f_string_le = compare(func(c int) bool { return c <= 0 })
+	f_string_ge = compare(func(c int) bool { return c >= 0 })
+)
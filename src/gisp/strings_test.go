@@ -0,0 +1,125 @@
+package main
+
+import "testing"
+
+// Tests for the string type and library in strings.go
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello world"`, "hello world"},
+		{`"a (b) 'c"`, "a (b) 'c"},
+		{`"say \"hi\"\n"`, "say \"hi\"\n"},
+		{`"tab\there\\"`, "tab\there\\"},
+		{`""`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			x := readOne(tt.input)
+			if T(x) != STRG || text(x) != tt.expected {
+				t.Fatalf("%s should read as string %q", tt.input, tt.expected)
+			}
+			if got := quote(text(x)); got != tt.input {
+				t.Errorf("%s prints as %s", tt.input, got)
+			}
+		})
+	}
+}
+
+func TestStringInList(t *testing.T) {
+	initTinyLisp()
+	x := readOne(`(f "a b" g)`)
+	if T(car(cdr(x))) != STRG || text(car(cdr(x))) != "a b" || !equ(car(cdr(cdr(x))), atom("g")) {
+		t.Error(`(f "a b" g) should hold the string "a b" followed by g`)
+	}
+}
+
+func TestStringLibrary(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(string-append "ab" "cd" "")`, "abcd"},
+		{`(substring "héllo" 1 3)`, "él"},
+		{`(substring "hello" 2)`, "llo"},
+		{`(symbol->string 'foo)`, "foo"},
+		{`(number->string 3.5)`, "3.5"},
+		{`(string-upcase "abc")`, "ABC"},
+		{`(string-downcase "ABC")`, "abc"},
+		{`(string-join (string-split "a b  c") ",")`, "a,b,c"},
+		{`(string-join (string-split "a,b,,c" ",") "-")`, "a-b--c"},
+		{`(string-join '("a" "b"))`, "ab"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			result := evalAll(tt.input)
+			if T(result) != STRG || text(result) != tt.expected {
+				t.Errorf("%s should return %q", tt.input, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStringValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected L
+	}{
+		{`(string-length "héllo")`, 5},
+		{`(string->number "42.5")`, 42.5},
+		{`(string->number "forty")`, nilv},
+		{`(string? "a")`, tru},
+		{`(string? 'a)`, nilv},
+		{`(string=? "a" "a" "a")`, tru},
+		{`(string<? "a" "b" "c")`, tru},
+		{`(string<? "a" "c" "b")`, nilv},
+		{`(string>=? "b" "b" "a")`, tru},
+		{`(eq? (string->symbol "car") 'car)`, tru},
+		{`(substring "abc" 2 1)`, err},
+		{`(substring "abc")`, err},
+		{`(substring "abc" 'x)`, err},
+		{`(substring "abc" 1 'x)`, err},
+		{`(substring "abc" -1)`, err},
+		{`(substring "abc" 0 4)`, err},
+		{`(string-length 'abc)`, err},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			if result := evalAll(tt.input); !equ(result, tt.expected) {
+				t.Errorf("%s = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStringToExactNumber(t *testing.T) {
+	for _, s := range []string{"1/2", "123456789012345678901234567890", "-7"} {
+		initTinyLisp()
+		if got := printed(evalAll(`(string->number "` + s + `")`)); got != s {
+			t.Errorf("(string->number %q) = %s, want the exact number", s, got)
+		}
+	}
+	initTinyLisp()
+	if x := evalAll(`(string->number " #xff ")`); !equ(x, L(255)) {
+		t.Error("string->number should read numbers like the reader")
+	}
+}
+
+func TestStringGC(t *testing.T) {
+	initTinyLisp()
+	evalAll(`(define s "kept")`)
+	n := len(strs)
+	evalAll(`(string-append s "!")`)
+	gc()
+	if len(strs) != n || text(assoc(atom("s"), env)) != "kept" {
+		t.Error("gc should free the strings created after the latest define and keep the others")
+	}
+}
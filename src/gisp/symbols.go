@@ -0,0 +1,98 @@
+package main
+
+import "strconv"
+
+// Symbols: gensym makes uninterned atoms, stored in A after a 1 byte that atom
+// never matches, so no atom read or made later is the same. Property lists are
+// lists of alternating keys and values kept by atom in plists next to A, rather
+// than in the environment.
+
+// Property lists by atom, and the number of atoms made by gensym
+var (
+	plists  map[I]L
+	gensyms int
+)
+
+// uninterned returns a new atom named s that is not the same as any other atom
+func uninterned(s string) L {
+	if hp+I(len(s))+2 > sp*cellSize {
+		panic("out of memory")
+	}
+	A[hp] = 1
+	copy(A[hp+1:], s)
+	A[hp+1+I(len(s))] = 0
+	x := box(ATOM, hp+1)
+	hp += I(len(s) + 2)
+	return x
+}
+
+// Return a new uninterned atom named by an optional string or atom prefix and a count
+func f_gensym(t, e L) L {
+	prefix := "g"
+	switch x := car(t); {
+	case T(t) != CONS:
+	case T(x) == STRG:
+		prefix = text(x)
+	case T(x) == ATOM:
+		prefix = name(x)
+	default:
+		return err
+	}
+	gensyms++
+	return uninterned(prefix + strconv.Itoa(gensyms))
+}
+
+// plist returns the property list of atom v
+func plist(v L) L {
+	if p, ok := plists[ord(v)]; ok {
+		return p
+	}
+	return nilv
+}
+
+// property returns the list in the property list of atom v that starts with key k, () if absent
+func property(v, k L) L {
+	p := plist(v)
+	for T(p) == CONS && !equ(car(p), k) {
+		p = cdr(cdr(p))
+	}
+	return p
+}
+
+// Return the value of a property of an atom, or the optional default or () if absent
+func f_get(t, e L) L {
+	if T(car(t)) != ATOM {
+		return err
+	}
+	if p := property(car(t), car(cdr(t))); T(p) == CONS {
+		return car(cdr(p))
+	}
+	if d := cdr(cdr(t)); T(d) == CONS {
+		return car(d)
+	}
+	return nilv
+}
+
+// Set a property of an atom, returning the value
+func f_put(t, e L) L {
+	v, k, x := car(t), car(cdr(t)), car(cdr(cdr(t)))
+	if T(v) != ATOM {
+		return err
+	}
+	if p := property(v, k); T(p) == CONS {
+		cell[ord(cdr(p))+1] = x
+		retain(x)
+	} else {
+		plists[ord(v)] = cons(k, cons(x, plist(v)))
+		keep()
+	}
+	return x
+}
+
+// Return the property list of an atom
+func f_symbol_plist(t, e L) L {
+	if T(car(t)) != ATOM {
+		return err
+	}
+	return plist(car(t))
+}
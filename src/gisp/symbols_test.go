@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+// Tests for gensym and the property lists in symbols.go
+
+func TestGensym(t *testing.T) {
+	initTinyLisp()
+	a, b := evalAll("(gensym)"), evalAll("(gensym 'tmp)")
+	if T(a) != ATOM || T(b) != ATOM || equ(a, b) {
+		t.Fatal("gensym should return distinct atoms")
+	}
+	if name(a) != "g1" || name(b) != "tmp2" {
+		t.Errorf("gensym made %s and %s, want g1 and tmp2", name(a), name(b))
+	}
+	if equ(atom("g1"), a) || equ(readOne("tmp2"), b) {
+		t.Error("atoms made by gensym should differ from atoms of the same name")
+	}
+	if result := evalAll("(define s (gensym)) (eq? s s)"); !equ(result, tru) {
+		t.Error("an atom made by gensym should be eq? to itself")
+	}
+	if result := evalAll("(gensym 3)"); !equ(result, err) {
+		t.Error("gensym should reject a prefix that is not a string or atom")
+	}
+}
+
+func TestPropertyLists(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected L
+	}{
+		{"(get 'f 'size)", 3},
+		{"(get 'f 'weight)", nilv},
+		{"(get 'f 'weight 0)", 0},
+		{"(get 'g 'size)", nilv},
+		{"(let* (_ (put 'f 'size 4)) (get 'f 'size))", 4},
+		{"(eq? (car (cdr (cdr (cdr (symbol-plist 'f))))) 'red)", tru},
+		{"(symbol-plist 'g)", nilv},
+		{"(get 3 'size)", err},
+		{"(put \"f\" 'size 1)", err},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			evalAll("(put 'f 'color 'red) (put 'f 'size 3)")
+			if result := evalAll(tt.input); !equ(result, tt.expected) {
+				t.Errorf("%s = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPropertyListsSurviveGC(t *testing.T) {
+	initTinyLisp()
+	evalAll("(put 'f 'items '(1 2 3))")
+	gc()
+	evalAll("(cons 4 (cons 5 (cons 6 ())))")
+	if result := evalAll("(car (cdr (get 'f 'items)))"); !equ(result, L(2)) {
+		t.Errorf("property value after gc = %v, want 2", result)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+// Vectors: contiguous blocks of cells allocated on the stack like conses and
+// boxed with the VECT tag. The first cell holds the length, the elements follow.
+
+// vector allocates a vector of n elements set to x
+func vector(n int, x L) L {
+	if I(n)+1 > sp || hp > (sp-I(n)-1)*cellSize {
+		panic("out of memory")
+	}
+	sp -= I(n) + 1
+	cell[sp] = L(n)
+	for i := sp + 1; i <= sp+I(n); i++ {
+		cell[i] = x
+	}
+	return box(VECT, sp)
+}
+
+// vlen returns the number of elements of vector v
+func vlen(v L) int {
+	return int(cell[ord(v)])
+}
+
+// elem returns the index in cell of element i of vector v, false if v has no element i
+func elem(v, i L) (I, bool) {
+	if T(v) != VECT || !(i >= 0 && int(i) < vlen(v)) {
+		return 0, false
+	}
+	return ord(v) + 1 + I(i), true
+}
+
+// listVector returns a vector of the elements of list t
+func listVector(t L) L {
+	n := 0
+	for x := t; T(x) == CONS; x = cdr(x) {
+		n++
+	}
+	v := vector(n, nilv)
+	for i := ord(v) + 1; T(t) == CONS; i, t = i+1, cdr(t) {
+		cell[i] = car(t)
+	}
+	return v
+}
+
+// Return #t if the argument is a vector
+func f_vectorp(t, e L) L {
+	if T(car(t)) == VECT {
+		return tru
+	}
+	return nilv
+}
+
+// Make a vector of a given length, filled with an optional value or ()
+func f_make_vector(t, e L) L {
+	n := car(t)
+	if !(n >= 0 && n < N) {
+		return err
+	}
+	x := nilv
+	if T(cdr(t)) == CONS {
+		x = car(cdr(t))
+	}
+	return vector(int(n), x)
+}
+
+// Make a vector of the arguments
+func f_vector(t, e L) L {
+	return listVector(t)
+}
+
+// Return the element of a vector at an index
+func f_vector_ref(t, e L) L {
+	if i, ok := elem(car(t), car(cdr(t))); ok {
+		return cell[i]
+	}
+	return err
+}
+
+// Set the element of a vector at an index, returning the value
+func f_vector_set(t, e L) L {
+	i, ok := elem(car(t), car(cdr(t)))
+	if !ok {
+		return err
+	}
+	cell[i] = car(cdr(cdr(t)))
+	retain(cell[i])
+	return cell[i]
+}
+
+// Return the number of elements of a vector
+func f_vector_length(t, e L) L {
+	if T(car(t)) != VECT {
+		return err
+	}
+	return L(vlen(car(t)))
+}
+
+// Return the list of elements of a vector
+func f_vector_list(t, e L) L {
+	v := car(t)
+	if T(v) != VECT {
+		return err
+	}
+	x := nilv
+	for i := ord(v) + I(vlen(v)); i > ord(v); i-- {
+		x = cons(cell[i], x)
+	}
+	return x
+}
+
+// Return a vector of the elements of a list
+func f_list_vector(t, e L) L {
+	return listVector(car(t))
+}
+
+// Return a vector of the results of applying a function to each element of a vector
+func f_vector_map(t, e L) L {
+	f, v := car(t), car(cdr(t))
+	if T(v) != VECT {
+		return err
+	}
+	w := vector(vlen(v), nilv)
+	for i := 1; i <= vlen(v); i++ {
+		cell[ord(w)+I(i)] = invoke(f, cons(cell[ord(v)+I(i)], nilv))
+	}
+	return w
+}
+
+// Set every element of a vector to a value, returning the vector
+func f_vector_fill(t, e L) L {
+	v := car(t)
+	if T(v) != VECT {
+		return err
+	}
+	for i := ord(v) + 1; i <= ord(v)+I(vlen(v)); i++ {
+		cell[i] = car(cdr(t))
+	}
+	retain(car(cdr(t)))
+	return v
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+// Tests for the vector type in vectors.go
+
+func TestVectorLiteral(t *testing.T) {
+	initTinyLisp()
+	v := readOne(`#(1 (2 3) "s" #\a)`)
+	if T(v) != VECT || vlen(v) != 4 {
+		t.Fatal(`#(1 (2 3) "s" #\a) should read as a vector of 4 elements`)
+	}
+	if !equ(cell[ord(v)+1], L(1)) || !equal(cell[ord(v)+2], readOne("(2 3)")) || !equ(cell[ord(v)+4], char('a')) {
+		t.Error("vector elements should be read in order")
+	}
+	if x := eval(v, env); !equ(x, v) {
+		t.Error("a vector should evaluate to itself")
+	}
+	if v := readOne("#()"); T(v) != VECT || vlen(v) != 0 {
+		t.Error("#() should read as an empty vector")
+	}
+}
+
+func TestVectorLibrary(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected L
+	}{
+		{"(vector-length (make-vector 5))", 5},
+		{"(vector-ref (make-vector 3 7) 2)", 7},
+		{"(vector-ref (vector 1 2 3) 1)", 2},
+		{"(vector-ref (vector 1 2 3) 3)", err},
+		{"(vector-ref (vector 1 2 3) -1)", err},
+		{"(let* (v (make-vector 2 0)) (_ (vector-set! v 0 5)) (vector-ref v 0))", 5},
+		{"(car (cdr (vector->list #(1 2 3))))", 2},
+		{"(vector-ref (list->vector '(4 5 6)) 2)", 6},
+		{"(vector-ref (vector-map (lambda (x) (* x x)) #(1 2 3)) 2)", 9},
+		{"(vector-ref (vector-fill! (make-vector 3) 4) 1)", 4},
+		{"(vector? #(1))", tru},
+		{"(vector? '(1))", nilv},
+		{"(pair? #(1))", nilv},
+		{"(make-vector -1)", err},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			initTinyLisp()
+			if result := evalAll(tt.input); !equ(result, tt.expected) {
+				t.Errorf("%s = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVectorGC(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define v (make-vector 3 0))")
+	gc()
+	evalAll("(vector-set! v 1 '(a b))")
+	gc()
+	evalAll("(cons 1 2)")
+	gc()
+	if x := evalAll("(vector-ref v 1)"); !equal(x, readOne("(a b)")) {
+		t.Error("gc should keep a list stored in a vector")
+	}
+}
+
+func TestVectorSetReclaimed(t *testing.T) {
+	initTinyLisp()
+	evalAll("(define v (make-vector 1 0))")
+	gc()
+	mark := sp
+	for i := 0; i < 5000; i++ {
+		evalAll("(vector-set! v 0 7)")
+		gc()
+	}
+	if sp != mark {
+		t.Errorf("storing a number should not keep the forms from gc, %d cells lost", mark-sp)
+	}
+	evalAll("(vector-set! v 0 (cons 1 2))")
+	gc()
+	evalAll("(cons 3 4)")
+	gc()
+	if x := evalAll("(vector-ref v 0)"); !equal(x, readOne("(1 . 2)")) {
+		t.Error("gc should keep a pair made by the form storing it")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import "encoding/binary"
+
+// Bytecode virtual machine running the code produced by compile.go.
+// A compiled closure is a CLOS whose body is boxed with the CODE tag and
+// whose environment is the list of values it captured, so compiled and
+// interpreted closures can call each other and print alike. The VM is not the
+// fast path: decoding each instruction makes it about 1.5 times as slow as the
+// closures of analyze.go on proto/nqueens.lisp (go test -bench Queens), so -vm
+// is for inspecting compiled code with disassemble rather than for speed.
+
+// frame is an active call of compiled code
+type frame struct {
+	p  *proto
+	pc int
+	bp int // stack index of slot 0, the function is just below it
+	n  int // number of calls being evaluated when the frame was entered
+}
+
+// machine holds the value stack and the frames of one VM activation
+type machine struct {
+	s  []L
+	fs []frame
+}
+
+// execTop compiles and runs a top-level expression, making ERR as its failure if
+// it cannot be compiled
+func execTop(x L) L {
+	p, e := compile(x)
+	if e != nil {
+		failure = x
+		return err
+	}
+	codes = append(codes, p)
+	return execute(box(CLOS, ord(pair(nilv, entry(CODE, len(codes)), nilv))), nilv)
+}
+
+// execute calls compiled closure f with the list of arguments t
+func execute(f, t L) L {
+	m := &machine{}
+	m.push(f)
+	n := 0
+	for ; T(t) == CONS; t = cdr(t) {
+		m.push(car(t))
+		n++
+	}
+	m.enter(n, nilv)
+	return m.run()
+}
+
+func (m *machine) push(x L) {
+	m.s = append(m.s, x)
+}
+
+func (m *machine) pop() L {
+	x := m.s[len(m.s)-1]
+	m.s = m.s[:len(m.s)-1]
+	return x
+}
+
+// list pops n values into a list
+func (m *machine) list(n int) L {
+	t := nilv
+	for i := len(m.s) - 1; i >= len(m.s)-n; i-- {
+		t = cons(m.s[i], t)
+	}
+	m.s = m.s[:len(m.s)-n]
+	return t
+}
+
+// spread pushes the elements of list t, returning their number
+func (m *machine) spread(t L) int {
+	n := 0
+	for ; T(t) == CONS; t = cdr(t) {
+		m.push(car(t))
+		n++
+	}
+	return n
+}
+
+// compiled returns the code of f if it is a compiled closure
+func compiled(f L) *proto {
+	if T(f) == CLOS && T(cdr(car(f))) == CODE {
+		return codes[ord(cdr(car(f)))]
+	}
+	return nil
+}
+
+// enter calls the function below the n arguments on top of the stack for call
+// x, pushing a frame for compiled code and the result for anything else
+func (m *machine) enter(n int, x L) {
+	f := m.s[len(m.s)-n-1]
+	p := compiled(f)
+	if p == nil || p.run != nil {
+		t := m.list(n)
+		m.s[len(m.s)-1] = called(x, f, t)
+		return
+	}
+	bp := len(m.s) - n
+	for ; n < p.nargs; n++ {
+		m.push(err)
+	}
+	if p.rest {
+		m.push(m.list(n - p.nargs))
+	} else {
+		m.s = m.s[:bp+p.nargs]
+	}
+	for len(m.s) < bp+p.nslots {
+		m.push(nilv)
+	}
+	m.spread(cdr(f))
+	m.fs = append(m.fs, frame{p, 0, bp, enterCall(x, f)})
+}
+
+// leave moves the function and n arguments on top of the stack over the current frame
+func (m *machine) leave(n int) {
+	fr := m.fs[len(m.fs)-1]
+	copy(m.s[fr.bp-1:], m.s[len(m.s)-n-1:])
+	m.s = m.s[:fr.bp+n]
+	m.fs = m.fs[:len(m.fs)-1]
+	calls = calls[:fr.n]
+}
+
+// run executes instructions until the outermost frame returns
+func (m *machine) run() L {
+	depth := len(m.fs) - 1
+	for len(m.fs) > depth {
+		fr := &m.fs[len(m.fs)-1]
+		at := fr.pc
+		op := fr.p.code[at]
+		var a, b int
+		if opArgs[op] > 0 {
+			a = int(binary.LittleEndian.Uint16(fr.p.code[fr.pc+1:]))
+		}
+		if opArgs[op] > 1 {
+			b = int(binary.LittleEndian.Uint16(fr.p.code[fr.pc+3:]))
+		}
+		fr.pc += 1 + 2*opArgs[op]
+		switch op {
+		case opConst:
+			m.push(fr.p.consts[a])
+		case opLocal:
+			m.push(m.s[fr.bp+a])
+		case opFree:
+			m.push(m.s[fr.bp+fr.p.nslots+a])
+		case opGlobal:
+			m.push(globals[a])
+		case opSet:
+			m.s[fr.bp+a] = m.pop()
+		case opDefine:
+			define(fr.p.consts[a], m.pop())
+			m.push(fr.p.consts[a])
+		case opPop:
+			m.pop()
+		case opJump:
+			fr.pc = a
+		case opFalse:
+			if notv(m.pop()) {
+				fr.pc = a
+			}
+		case opAnd:
+			if notv(m.s[len(m.s)-1]) {
+				fr.pc = a
+			} else {
+				m.pop()
+			}
+		case opOr:
+			if !notv(m.s[len(m.s)-1]) {
+				fr.pc = a
+			} else {
+				m.pop()
+			}
+		case opClosure:
+			x := fr.p.consts[a]
+			m.push(box(CLOS, ord(pair(codes[ord(x)].params, x, m.list(b)))))
+		case opCall:
+			m.enter(a, fr.p.site(at))
+		case opTail:
+			x := fr.p.site(at)
+			m.leave(a)
+			m.enter(a, x)
+		case opSpread:
+			m.enter(a+m.spread(m.pop()), fr.p.site(at))
+		case opTailSpread:
+			x := fr.p.site(at)
+			a += m.spread(m.pop())
+			m.leave(a)
+			m.enter(a, x)
+		case opEval:
+			x := fr.p.consts[a]
+			e := env
+			for v, i := cdr(x), len(m.s)-b; T(v) == CONS; v, i = cdr(v), i+1 {
+				e = pair(car(v), m.s[i], e)
+			}
+			m.s = m.s[:len(m.s)-b]
+			m.push(eval(car(x), e))
+		case opReturn:
+			x := m.pop()
+			m.s = m.s[:fr.bp-1]
+			m.fs = m.fs[:len(m.fs)-1]
+			calls = calls[:fr.n]
+			m.push(x)
+		}
+	}
+	return m.pop()
+}
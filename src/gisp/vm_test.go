@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests for the bytecode compiler and VM, running the same expressions as the interpreter
+
+// runAll parses and runs every expression in input with the VM, returning the last result
+func runAll(input string) L {
+	p := newReader(strings.NewReader(input))
+	x := nilv
+	for y, e := p.read(); e == nil; y, e = p.read() {
+		x = execTop(y)
+	}
+	return x
+}
+
+func TestVMMatchesInterpreter(t *testing.T) {
+	tests := []string{
+		"(+ 1 2 3 4)",
+		"(- 10 3 2)",
+		"(* (+ 1 2) (- 5 2))",
+		"(< 1 2)",
+		"(eq? 'hello 'world)",
+		"(not ())",
+		"(and #t 1 2)",
+		"(and #t () 2)",
+		"(and)",
+		"(or () 3)",
+		"(or)",
+		"(car (cons 1 2))",
+		"(pair? '(1))",
+		"(if () 42 24)",
+		"(if () 42)",
+		"(cond (() 1) (#t 2))",
+		"(cond (() 1))",
+		"(cond (#t 42) (else 24))",
+		"(let* (x 1) (y (+ x 1)) (+ x y))",
+		"((lambda (x y) (+ x y)) 3 4)",
+		"((lambda (x y) (cons x y)) 1)",
+		"((lambda args args) 1 2 3)",
+		"((lambda (x . y) y) 1 2 3)",
+		"(((lambda (x) (lambda (y) (+ x y))) 10) 5)",
+		"(((lambda (x) (let* (y 2) (lambda (z) (+ x y z)))) 1) 3)",
+		"((lambda (l) (+ . l)) '(1 2 3))",
+		"(((lambda (f x) (lambda args (f x . args))) + 1) 2 3)",
+		"(eval '(+ 1 2))",
+		"((lambda (if) (if 1 2)) cons)",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			initTinyLisp()
+			want := eval(readOne(tt), env)
+			got := execTop(readOne(tt))
+			if !equal(got, want) {
+				t.Errorf("%s: VM returned %v, interpreter returned %v", tt, got, want)
+			}
+		})
+	}
+}
+
+func TestVMDefine(t *testing.T) {
+	initTinyLisp()
+	result := runAll(`
+		(define fact (lambda (n) (if (< n 2) 1 (* n (fact (- n 1))))))
+		(fact 10)`)
+	if !equ(result, L(3628800)) {
+		t.Errorf("(fact 10) = %f, want 3628800", float64(result))
+	}
+	if compiled(assoc(atom("fact"), env)) == nil {
+		t.Error("fact should be a compiled closure")
+	}
+}
+
+func TestVMTailCalls(t *testing.T) {
+	initTinyLisp()
+	result := runAll(`
+		(define count (lambda (n) (if (< 0 n) (count (- n 1)) 'done)))
+		(count 2000)`)
+	if !equ(result, atom("done")) {
+		t.Errorf("tail recursive count should return done")
+	}
+}
+
+func TestVMCallsInterpreted(t *testing.T) {
+	initTinyLisp()
+	eval(readOne("(define twice (lambda (f x) (f (f x))))"), env)
+	result := runAll("(twice (lambda (x) (* x 3)) 2)")
+	if !equ(result, L(18)) {
+		t.Errorf("interpreted twice of compiled lambda = %f, want 18", float64(result))
+	}
+	result = eval(readOne("((lambda (g) (g 4)) twice2)"), pair(atom("twice2"), runAll("(lambda (x) (+ x x))"), env))
+	if !equ(result, L(8)) {
+		t.Errorf("interpreted call of compiled lambda = %f, want 8", float64(result))
+	}
+}
+
+func TestVMCodesReclaimed(t *testing.T) {
+	saved := run
+	run = execTop
+	defer func() { run = saved }()
+	out := session("(define sq (lambda (x) (* x x)))\n" + strings.Repeat("((lambda (y) (sq y)) 3)\n", 100) + "(sq 4)\n")
+	if n := len(codes); n > 3 {
+		t.Errorf("a REPL session on the VM kept the code of %d forms and closures, want at most 3", n)
+	}
+	if !strings.Contains(out, "> 16") {
+		t.Errorf("a function defined earlier in the session should keep its code:\n%s", out)
+	}
+}
+
+func TestVMDotCall(t *testing.T) {
+	initTinyLisp()
+	content, e := os.ReadFile("../../tests/dotcall.lisp")
+	if e != nil {
+		t.Skip("tests/dotcall.lisp not found")
+	}
+	p := newReader(bytes.NewReader(content))
+	for x, e := p.read(); e == nil; x, e = p.read() {
+		x = execTop(x)
+		if T(x) == CONS && !equ(car(x), atom("passed")) {
+			t.Errorf("dotcall test failed: %v", cdr(x))
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	initTinyLisp()
+	f := runAll("(define sq (lambda (x) (* x x)))")
+	if !equ(f_disassemble(cons(assoc(f, env), nilv), env), tru) {
+		t.Error("disassemble should accept a compiled closure")
+	}
+	g := eval(readOne("(lambda (x) (+ x 1))"), env)
+	if !equ(f_disassemble(cons(g, nilv), env), tru) {
+		t.Error("disassemble should compile an interpreted closure")
+	}
+	if !equ(f_disassemble(cons(L(1), nilv), env), err) {
+		t.Error("disassemble of a number should return ERR")
+	}
+}
+
+func TestVMOperandOverflow(t *testing.T) {
+	initTinyLisp()
+	// 12000 elements of and take 6 bytes of code each, beyond the 16-bit jumps
+	x := readOne("(and" + strings.Repeat(" 1", 12000) + ")")
+	if y := execTop(x); !equ(y, err) || !equ(failure, x) {
+		t.Error("a form with jumps beyond 16 bits should fail to compile")
+	}
+	if _, e := compile(readOne("(and 1 2)")); e != nil {
+		t.Errorf("a small form should compile, got %v", e)
+	}
+	c := &compiler{p: &proto{}}
+	if e := checked(func() { c.emit(opConst, math.MaxUint16+1) }); !errors.Is(e, errOperand) {
+		t.Errorf("an operand beyond 16 bits should be reported, got %v", e)
+	}
+}
+
+// benchmarkQueens solves the 4 queens problem with proto/nqueens.lisp and the
+// src/common.lisp it requires, run by run. Larger boards do not fit in the N
+// cells, since gc only runs between top-level forms.
+func benchmarkQueens(b *testing.B, run func(L) L) {
+	initTinyLisp()
+	for _, file := range []string{"../common.lisp", "../../proto/nqueens.lisp"} {
+		content, e := os.ReadFile(file)
+		if e != nil {
+			b.Skip(file + " not found")
+		}
+		p := newReader(bytes.NewReader(content))
+		for x, e := p.read(); e == nil; x, e = p.read() {
+			if !equ(car(x), atom("solve")) {
+				run(x)
+			}
+		}
+	}
+	run(readOne("(define board-size 4)"))
+	gc()
+	x := readOne("(solve (make-board board-size))")
+	mark := sp
+	if out := stdout(func() { run(x) }); strings.Count(out, "@") != 8 {
+		b.Fatalf("4 queens should have 2 solutions:\n%s", out)
+	}
+	sp = mark
+	stdout(func() {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			run(x)
+			sp = mark
+		}
+	})
+}
+
+func BenchmarkQueensEval(b *testing.B) {
+	benchmarkQueens(b, func(x L) L { return eval(x, env) })
+}
+
+func BenchmarkQueensVM(b *testing.B) {
+	benchmarkQueens(b, execTop)
+}